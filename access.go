@@ -0,0 +1,228 @@
+package config
+
+import (
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/go-viper/mapstructure/v2"
+	"github.com/roadrunner-server/errors"
+)
+
+// UnmarshalKeyStrict reads a configuration section into a configuration object, like
+// UnmarshalKey, and fails on the keys of the section the object has no field for.
+func (p *Plugin) UnmarshalKeyStrict(name string, out any) error {
+	const op = errors.Op("config_plugin_unmarshal_key_strict")
+	return p.unmarshal(op, name, out, true)
+}
+
+// UnmarshalStrict reads the whole configuration into a configuration object, like
+// Unmarshal, and fails on the keys the object has no field for.
+func (p *Plugin) UnmarshalStrict(out any) error {
+	const op = errors.Op("config_plugin_unmarshal_strict")
+	return p.unmarshal(op, "", out, true)
+}
+
+// unmarshal decodes the key, the whole configuration when empty, into out. The keys the
+// decoder consumed are marked as read, and in the strict mode the ones it didn't are
+// reported with their full path.
+func (p *Plugin) unmarshal(op errors.Op, key string, out any, strict bool) error {
+	md := &mapstructure.Metadata{}
+	withMetadata := func(c *mapstructure.DecoderConfig) { c.Metadata = md }
+
+	p.mu.RLock()
+	var err error
+	if key == "" {
+		err = p.viper.Unmarshal(&out, withMetadata)
+	} else {
+		err = p.viper.UnmarshalKey(key, &out, withMetadata)
+	}
+	p.mu.RUnlock()
+
+	if err != nil {
+		return errors.E(op, err)
+	}
+
+	p.markDecoded(key, out, md.Keys)
+
+	if (strict || p.StrictUnmarshal) && len(md.Unused) > 0 {
+		unknown := make([]string, 0, len(md.Unused))
+		for _, k := range md.Unused {
+			unknown = append(unknown, joinKey(key, k))
+		}
+		slices.Sort(unknown)
+
+		return errors.E(op, errors.Errorf("unknown configuration keys: %s", strings.Join(unknown, ", ")))
+	}
+
+	return nil
+}
+
+// markDecoded marks the keys decoded under prefix as read. A key the decoder went into,
+// such as a nested struct, is read only as far as its own fields go, the other ones are
+// read with the keys under them. Anything but a struct reads the whole prefix.
+func (p *Plugin) markDecoded(prefix string, out any, decoded []string) {
+	if !decodesStruct(out) {
+		p.markRead(prefix)
+		return
+	}
+
+	keys := make([]string, 0, len(decoded))
+	for _, k := range decoded {
+		// lists are values of their own, an item read reads the list; the items of a map
+		// field stand for the map
+		if i := strings.IndexByte(k, '['); i >= 0 {
+			k = k[:i]
+		}
+
+		keys = append(keys, joinKey(prefix, strings.ToLower(k)))
+	}
+
+	for _, k := range keys {
+		partial := slices.ContainsFunc(keys, func(other string) bool { return strings.HasPrefix(other, k+".") })
+		if partial {
+			p.markTouched(k)
+		} else {
+			p.markRead(k)
+		}
+	}
+}
+
+// markTouched records the keys as accessed, without the keys under them: Has checks a
+// section exists, and a struct only decodes the keys it has fields for.
+func (p *Plugin) markTouched(keys ...string) {
+	p.readMu.Lock()
+	defer p.readMu.Unlock()
+
+	if p.touched == nil {
+		p.touched = make(map[string]struct{})
+	}
+
+	for _, k := range keys {
+		p.touched[strings.ToLower(k)] = struct{}{}
+	}
+}
+
+// markRead records the keys as read along with everything under them, an empty key
+// stands for the whole configuration.
+func (p *Plugin) markRead(keys ...string) {
+	p.readMu.Lock()
+	defer p.readMu.Unlock()
+
+	if p.reads == nil {
+		p.reads = make(map[string]struct{})
+	}
+
+	for _, k := range keys {
+		p.reads[strings.ToLower(k)] = struct{}{}
+	}
+}
+
+// isRead reports whether the key, or a section holding it, was read. The caller holds
+// readMu.
+func (p *Plugin) isRead(key string) bool {
+	if _, ok := p.reads[""]; ok {
+		return true
+	}
+
+	for {
+		if _, ok := p.reads[key]; ok {
+			return true
+		}
+
+		i := strings.LastIndexByte(key, '.')
+		if i < 0 {
+			return false
+		}
+
+		key = key[:i]
+	}
+}
+
+// UnusedKeys returns the parts of the configuration no plugin accessed through Get, Has,
+// UnmarshalKey or Unmarshal, sorted. A section nothing under which was accessed is
+// reported as a whole rather than key by key, such as kv for a binary built without
+// the kv plugin, while a used section reports the keys no plugin read, such as a
+// misspelled one its struct has no field for. A section decoded into a map or read as a
+// whole with Get counts as read along with its keys. The keys the config plugin consumes
+// itself are left out. The report is meaningful once every plugin is initialized, Serve
+// emits it as warnings.
+func (p *Plugin) UnusedKeys() []string {
+	p.mu.RLock()
+	settings := p.viper.AllSettings()
+	p.mu.RUnlock()
+
+	p.readMu.Lock()
+	defer p.readMu.Unlock()
+
+	for _, k := range []string{versionKey, includeKey, envFileKey} {
+		delete(settings, k)
+	}
+
+	var unused []string
+	p.collectUnused("", settings, &unused)
+
+	return unused
+}
+
+// collectUnused walks the section at prefix. The caller holds readMu.
+func (p *Plugin) collectUnused(prefix string, section map[string]any, unused *[]string) {
+	for _, k := range slices.Sorted(maps.Keys(section)) {
+		key := joinKey(prefix, k)
+		switch {
+		case p.isRead(key):
+			continue
+		case !p.isAccessed(key):
+			*unused = append(*unused, key)
+		default:
+			if nested, ok := section[k].(map[string]any); ok {
+				p.collectUnused(key, nested, unused)
+			}
+		}
+	}
+}
+
+// isAccessed reports whether the key or a key under it was accessed. The caller holds
+// readMu.
+func (p *Plugin) isAccessed(key string) bool {
+	for _, set := range []map[string]struct{}{p.reads, p.touched} {
+		for k := range set {
+			if k == key || strings.HasPrefix(k, key+".") {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// reportUnused raises a warning for every unused part of the configuration.
+func (p *Plugin) reportUnused() {
+	if p.viper == nil {
+		return
+	}
+
+	for _, key := range p.UnusedKeys() {
+		p.warn(Warning{
+			Kind:    WarningUnusedKey,
+			Message: "no plugin uses this part of the configuration, it may be left over or belong to a plugin the binary doesn't include",
+			Key:     key,
+		})
+	}
+}
+
+// decodesStruct reports whether out ends in a struct, through the pointers and the
+// interfaces holding it.
+func decodesStruct(out any) bool {
+	v := reflect.ValueOf(out)
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return false
+		}
+
+		v = v.Elem()
+	}
+
+	return v.Kind() == reflect.Struct
+}
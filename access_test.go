@@ -0,0 +1,106 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const accessConfig = `version: "3"
+http:
+  address: 127.0.0.1:8080
+  adress: typo
+  pool:
+    num_workers: 4
+    max_jobz: 10
+  headers:
+    x-a: b
+kv:
+  local:
+    driver: memory
+`
+
+type httpConfig struct {
+	Address string            `mapstructure:"address"`
+	Headers map[string]string `mapstructure:"headers"`
+	Pool    struct {
+		NumWorkers int `mapstructure:"num_workers"`
+		MaxJobs    int `mapstructure:"max_jobs"`
+	} `mapstructure:"pool"`
+}
+
+func TestUnmarshalKeyStrict(t *testing.T) {
+	p := initFromYAML(t, accessConfig)
+
+	var cfg httpConfig
+	err := p.UnmarshalKeyStrict("http", &cfg)
+	require.ErrorContains(t, err, "config_plugin_unmarshal_key_strict")
+	assert.ErrorContains(t, err, "unknown configuration keys: http.adress, http.pool.max_jobz")
+
+	// the lenient variant ignores them
+	require.NoError(t, p.UnmarshalKey("http", &cfg))
+	assert.Equal(t, 4, cfg.Pool.NumWorkers)
+}
+
+func TestStrictUnmarshalOption(t *testing.T) {
+	p := &Plugin{Path: writeYAML(t, accessConfig), StrictUnmarshal: true}
+	require.NoError(t, p.Init())
+
+	var cfg httpConfig
+	require.ErrorContains(t, p.UnmarshalKey("http", &cfg), "unknown configuration keys: http.adress, http.pool.max_jobz")
+
+	var root struct {
+		Version string `mapstructure:"version"`
+	}
+	require.ErrorContains(t, p.Unmarshal(&root), "unknown configuration keys: http, kv")
+
+	var kv map[string]any
+	require.NoError(t, p.UnmarshalKey("kv", &kv))
+}
+
+func TestUnusedKeys(t *testing.T) {
+	p := initFromYAML(t, accessConfig+"jobs:\n  num_pollers: 1\n")
+
+	// nothing accessed, every section is unused as a whole
+	assert.Equal(t, []string{"http", "jobs", "kv"}, p.UnusedKeys())
+
+	// a section only checked for is used, its keys are not
+	assert.True(t, p.Has("jobs"))
+	assert.Equal(t, []string{"http", "jobs.num_pollers", "kv"}, p.UnusedKeys())
+
+	var cfg httpConfig
+	require.NoError(t, p.UnmarshalKey("http", &cfg))
+	assert.Equal(t, []string{"http.adress", "http.pool.max_jobz", "jobs.num_pollers", "kv"}, p.UnusedKeys())
+
+	_ = p.Get("kv.local.driver")
+	assert.Equal(t, []string{"http.adress", "http.pool.max_jobz", "jobs.num_pollers"}, p.UnusedKeys())
+
+	// a section read as a whole reads its keys
+	_ = p.Get("jobs")
+	assert.Equal(t, []string{"http.adress", "http.pool.max_jobz"}, p.UnusedKeys())
+
+	var all map[string]any
+	require.NoError(t, p.Unmarshal(&all))
+	assert.Empty(t, p.UnusedKeys())
+}
+
+func TestServeReportsUnusedKeys(t *testing.T) {
+	p := initFromYAML(t, accessConfig)
+	assert.True(t, p.Has("http"))
+	_ = p.Get("http")
+
+	log, logs := observedLogger()
+	p.SetLogger(log)
+
+	errCh := p.Serve()
+	require.NoError(t, p.Stop(t.Context()))
+	assert.Empty(t, errCh)
+
+	assert.Equal(t, []Warning{{
+		Kind:    WarningUnusedKey,
+		Message: "no plugin uses this part of the configuration, it may be left over or belong to a plugin the binary doesn't include",
+		Key:     "kv",
+	}}, p.Warnings())
+	assert.Equal(t, 1, logs.Len())
+}
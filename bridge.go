@@ -0,0 +1,24 @@
+package config
+
+// LoggerPluginName is the name of the LoggerBridge plugin.
+const LoggerPluginName string = "config_logger"
+
+// warningSink is the config plugin, as the LoggerBridge sees it.
+type warningSink interface {
+	SetLogger(l Logger)
+}
+
+// LoggerBridge is the plugin handing the logger plugin to the config plugin. The logger
+// depends on the configuration, so the config plugin can't take it in its own Init:
+// registered along with both, the bridge is initialized after them and makes the
+// warnings, the unused keys report included, go through the logger instead of stderr.
+type LoggerBridge struct{}
+
+func (b *LoggerBridge) Init(cfg warningSink, log Logger) error {
+	cfg.SetLogger(log)
+	return nil
+}
+
+func (b *LoggerBridge) Name() string {
+	return LoggerPluginName
+}
@@ -0,0 +1,30 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestLoggerBridge checks the path the container takes: the bridge is initialized after
+// the config and logger plugins, and the warnings raised at boot and once served, such
+// as the unused keys, reach the logger.
+func TestLoggerBridge(t *testing.T) {
+	p := &Plugin{Path: writeYAML(t, legacyJobsConfig+"kv:\n  local:\n    driver: memory\n")}
+	require.NoError(t, p.Init())
+	_ = p.Get("jobs")
+
+	log, logs := observedLogger()
+	require.NoError(t, (&LoggerBridge{}).Init(p, log))
+	assert.Equal(t, LoggerPluginName, (&LoggerBridge{}).Name())
+
+	errCh := p.Serve()
+	require.NoError(t, p.Stop(t.Context()))
+	assert.Empty(t, errCh)
+
+	entries := logs.AllUntimed()
+	require.Len(t, entries, 2)
+	assert.Equal(t, "deprecated_version", entries[0].ContextMap()["kind"])
+	assert.Equal(t, map[string]any{"kind": "unused_key", "key": "kv"}, entries[1].ContextMap())
+}
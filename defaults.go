@@ -0,0 +1,145 @@
+package config
+
+import (
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/roadrunner-server/errors"
+	"github.com/spf13/viper"
+)
+
+// defaults are the values a plugin registered for its section.
+type defaults struct {
+	section string
+	values  map[string]any
+}
+
+// RegisterDefaults registers the default values of a section, such as the ones a plugin
+// sets in its InitDefaults. They are the lowest layer of the configuration: a value set
+// anywhere else wins, and a section is completed key by key. Only a section the
+// configuration sets is completed, the defaults never create it: a plugin tells it is
+// disabled by Has(section). The defaults apply right away and on every reload, Get, Has,
+// Dump and Origin see them as any other value.
+func (p *Plugin) RegisterDefaults(section string, values map[string]any) error {
+	const op = errors.Op("config_plugin_register_defaults")
+	if section == "" {
+		return errors.E(op, errors.Str("section should not be empty"))
+	}
+
+	d := defaults{section: strings.ToLower(section), values: values}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.origins == nil {
+		p.origins = make(origins)
+	}
+
+	if p.viper != nil {
+		applyDefaults(p.viper, p.origins, d)
+	}
+
+	p.defaults = append(p.defaults, d)
+
+	return nil
+}
+
+// applyRegisteredDefaults applies the registered defaults to a fresh configuration.
+func (p *Plugin) applyRegisteredDefaults(snap *snapshot) {
+	p.mu.RLock()
+	registered := p.defaults
+	p.mu.RUnlock()
+
+	for _, d := range registered {
+		applyDefaults(snap.viper, snap.origins, d)
+	}
+}
+
+// applyDefaults fills the keys of the section v lacks with the defaults, when v sets the
+// section. The top level section is set as a whole, viper only merges its layers key by
+// key, so a section read with Get or UnmarshalKey would not see defaults set below it.
+func applyDefaults(v *viper.Viper, o origins, d defaults) {
+	if !v.IsSet(d.section) {
+		return
+	}
+
+	tree := lowerKeys(d.values)
+	parts := strings.Split(d.section, ".")
+	for i := len(parts) - 1; i > 0; i-- {
+		tree = map[string]any{parts[i]: tree}
+	}
+
+	var added []string
+	merged := fillDefaults(v.Get(parts[0]), tree, parts[0], &added)
+	if len(added) == 0 {
+		return
+	}
+
+	v.Set(parts[0], merged)
+	for _, key := range added {
+		o.set(key, Origin{Layer: LayerDefault})
+	}
+}
+
+// fillDefaults returns val completed with the defaults it lacks, recording the keys it
+// added. val is not modified.
+func fillDefaults(val, def any, key string, added *[]string) any {
+	if val == nil {
+		collectLeaves(key, def, added)
+		return def
+	}
+
+	section, ok := val.(map[string]any)
+	defSection, defOk := def.(map[string]any)
+	if !ok || !defOk {
+		return val
+	}
+
+	out := maps.Clone(section)
+	for _, k := range slices.Sorted(maps.Keys(defSection)) {
+		out[k] = fillDefaults(out[k], defSection[k], joinKey(key, k), added)
+	}
+
+	return out
+}
+
+// collectLeaves records the keys holding a value in val, found at key.
+func collectLeaves(key string, val any, leaves *[]string) {
+	section, ok := val.(map[string]any)
+	if !ok || len(section) == 0 {
+		*leaves = append(*leaves, key)
+		return
+	}
+
+	for _, k := range slices.Sorted(maps.Keys(section)) {
+		collectLeaves(joinKey(key, k), section[k], leaves)
+	}
+}
+
+// lowerKeys returns a copy of the section with its keys lowercased, as viper has them.
+// A dotted key is nested: pool.num_workers is num_workers under pool.
+func lowerKeys(section map[string]any) map[string]any {
+	out := make(map[string]any, len(section))
+	for _, k := range slices.Sorted(maps.Keys(section)) {
+		val := section[k]
+		if nested, ok := val.(map[string]any); ok {
+			val = lowerKeys(nested)
+		}
+
+		parts := strings.Split(strings.ToLower(k), ".")
+		dst := out
+		for _, part := range parts[:len(parts)-1] {
+			next, ok := dst[part].(map[string]any)
+			if !ok {
+				next = make(map[string]any)
+				dst[part] = next
+			}
+			dst = next
+		}
+
+		dst[parts[len(parts)-1]] = val
+	}
+
+	return out
+}
@@ -0,0 +1,119 @@
+package config
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.yaml.in/yaml/v3"
+)
+
+const defaultsConfig = `version: "3"
+http:
+  address: 127.0.0.1:8080
+  pool:
+    num_workers: 4
+`
+
+var httpDefaults = map[string]any{
+	"address": "0.0.0.0:80",
+	"pool": map[string]any{
+		"num_workers":      1,
+		"allocate_timeout": "60s",
+	},
+	"Max_Request_Size": 1024,
+}
+
+func TestRegisterDefaults(t *testing.T) {
+	p := initFromYAML(t, defaultsConfig)
+
+	require.NoError(t, p.RegisterDefaults("http", httpDefaults))
+	require.NoError(t, p.RegisterDefaults("kv", map[string]any{"local.driver": "memory"}))
+
+	// the configured values win
+	assert.Equal(t, "127.0.0.1:8080", p.Get("http.address"))
+	assert.Equal(t, 4, p.Get("http.pool.num_workers"))
+	// the missing ones are filled in, nested sections included
+	assert.Equal(t, "60s", p.Get("http.pool.allocate_timeout"))
+	assert.Equal(t, 1024, p.Get("http.max_request_size"))
+	// a section the configuration lacks stays absent, the plugin owning it is disabled
+	assert.False(t, p.Has("kv"))
+	assert.Nil(t, p.Get("kv"))
+	assert.NotContains(t, p.UnusedKeys(), "kv")
+
+	var out struct {
+		Pool struct {
+			NumWorkers      int    `mapstructure:"num_workers"`
+			AllocateTimeout string `mapstructure:"allocate_timeout"`
+		} `mapstructure:"pool"`
+	}
+	require.NoError(t, p.UnmarshalKey("http", &out))
+	assert.Equal(t, 4, out.Pool.NumWorkers)
+	assert.Equal(t, "60s", out.Pool.AllocateTimeout)
+
+	o, ok := p.Origin("http.pool.allocate_timeout")
+	require.True(t, ok)
+	assert.Equal(t, Origin{Layer: LayerDefault}, o)
+	assert.Equal(t, "default", o.String())
+
+	o, ok = p.Origin("http.pool.num_workers")
+	require.True(t, ok)
+	assert.Equal(t, LayerFile, o.Layer)
+}
+
+func TestDefaultsInDump(t *testing.T) {
+	p := initFromYAML(t, defaultsConfig)
+	require.NoError(t, p.RegisterDefaults("http.pool", map[string]any{"max_jobs": 100}))
+
+	var buf bytes.Buffer
+	require.NoError(t, p.Dump(&buf, FormatYAML))
+
+	var out map[string]any
+	require.NoError(t, yaml.Unmarshal(buf.Bytes(), &out))
+	assert.Equal(t, map[string]any{"num_workers": 4, "max_jobs": 100}, out["http"].(map[string]any)["pool"])
+}
+
+// TestDefaultsSurviveReload checks that the defaults stay the lowest layer of the
+// reloaded configuration, and the values removed from the file fall back to them.
+func TestDefaultsSurviveReload(t *testing.T) {
+	path := writeYAML(t, defaultsConfig)
+	p := &Plugin{Path: path, Flags: []string{"http.pool.max_jobs=10"}}
+	require.NoError(t, p.Init())
+	require.NoError(t, p.RegisterDefaults("http", httpDefaults))
+
+	rewrite(t, path, "version: \"3\"\nhttp:\n  pool:\n    allocate_timeout: 10s\n")
+	require.NoError(t, p.Reload())
+
+	assert.Equal(t, "0.0.0.0:80", p.Get("http.address"))
+	assert.Equal(t, 1, p.Get("http.pool.num_workers"))
+	assert.Equal(t, "10s", p.Get("http.pool.allocate_timeout"))
+	assert.Equal(t, 10, p.Get("http.pool.max_jobs"))
+}
+
+// TestDefaultsFollowTheSection checks that the defaults complete a section from the
+// reload that sets it, and not once a reload drops it.
+func TestDefaultsFollowTheSection(t *testing.T) {
+	path := writeYAML(t, rpcConfig)
+	p := &Plugin{Path: path}
+	require.NoError(t, p.Init())
+	require.NoError(t, p.RegisterDefaults("http", httpDefaults))
+	assert.False(t, p.Has("http"))
+
+	rewrite(t, path, defaultsConfig)
+	require.NoError(t, p.Reload())
+	assert.Equal(t, "60s", p.Get("http.pool.allocate_timeout"))
+
+	rewrite(t, path, rpcConfig)
+	require.NoError(t, p.Reload())
+	assert.False(t, p.Has("http"))
+}
+
+func TestDefaultsDoNotReplaceValues(t *testing.T) {
+	p := initFromYAML(t, "version: \"3\"\nhttp: disabled\n")
+
+	require.NoError(t, p.RegisterDefaults("http", httpDefaults))
+	assert.Equal(t, "disabled", p.Get("http"))
+
+	require.ErrorContains(t, p.RegisterDefaults("", httpDefaults), "section should not be empty")
+}
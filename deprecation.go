@@ -0,0 +1,180 @@
+package config
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/roadrunner-server/errors"
+	"github.com/spf13/viper"
+)
+
+// Deprecation declares a configuration key a plugin no longer reads under its name.
+type Deprecation struct {
+	// Key is the deprecated key.
+	Key string
+	// NewKey replaces Key, the value set under Key is moved there. Empty when the key is
+	// deprecated with no replacement.
+	NewKey string
+	// Message is the warning raised when the configuration sets Key, a default one
+	// naming NewKey is used when empty.
+	Message string
+	// RemovedIn is the RoadRunner version Key stops being supported in, such as 2025.1.0.
+	RemovedIn string
+}
+
+// RegisterDeprecation registers a deprecated key, which is applied right away and on
+// every reload: a value set under Key is moved to NewKey, unless NewKey is set as well,
+// and a warning is raised once. With StrictDeprecations, a configuration still setting
+// Key once RRVersion reaches RemovedIn is an error.
+func (p *Plugin) RegisterDeprecation(d Deprecation) error {
+	const op = errors.Op("config_plugin_register_deprecation")
+	if d.Key == "" {
+		return errors.E(op, errors.Str("deprecated key should not be empty"))
+	}
+
+	p.mu.Lock()
+	v, w, err := p.applyDeprecation(p.viper, p.origins, d)
+	if err != nil {
+		p.mu.Unlock()
+		return errors.E(op, err)
+	}
+
+	p.viper = v
+	p.deprecations = append(p.deprecations, d)
+	p.mu.Unlock()
+
+	if w != nil {
+		p.warn(*w)
+	}
+
+	return nil
+}
+
+// applyDeprecations applies the registered deprecations to a fresh configuration.
+func (p *Plugin) applyDeprecations(snap *snapshot) error {
+	p.mu.RLock()
+	deprecations := p.deprecations
+	p.mu.RUnlock()
+
+	for _, d := range deprecations {
+		v, w, err := p.applyDeprecation(snap.viper, snap.origins, d)
+		if err != nil {
+			return err
+		}
+
+		snap.viper = v
+		if w != nil {
+			snap.warnings = append(snap.warnings, *w)
+		}
+	}
+
+	return nil
+}
+
+// applyDeprecation moves the value of the deprecated key and returns the configuration
+// holding the result, along with the warning to raise, if the key is set.
+func (p *Plugin) applyDeprecation(v *viper.Viper, o origins, d Deprecation) (*viper.Viper, *Warning, error) {
+	if v == nil || !v.IsSet(d.Key) {
+		return v, nil, nil
+	}
+
+	if p.StrictDeprecations && d.RemovedIn != "" && versionReached(p.Version, d.RemovedIn) {
+		msg := "key `" + d.Key + "` was removed in " + d.RemovedIn
+		if d.NewKey != "" {
+			msg += ", use `" + d.NewKey + "` instead"
+		}
+
+		return nil, nil, errors.Str(msg)
+	}
+
+	w := &Warning{
+		Kind:    WarningDeprecatedKey,
+		Message: d.Message,
+		Key:     d.Key,
+		Fields:  map[string]string{},
+	}
+
+	if w.Message == "" {
+		w.Message = "key `" + d.Key + "` is deprecated"
+		if d.NewKey != "" {
+			w.Message += ", use `" + d.NewKey + "` instead"
+		}
+	}
+
+	if d.RemovedIn != "" {
+		w.Fields["removed_in"] = d.RemovedIn
+	}
+
+	if d.NewKey == "" {
+		return v, w, nil
+	}
+
+	w.Fields["new_key"] = d.NewKey
+
+	val := v.Get(d.Key)
+	out, err := unset(v, d.Key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// the new key wins when both are set
+	if out.IsSet(d.NewKey) {
+		o.drop(d.Key)
+		return out, w, nil
+	}
+
+	out.Set(d.NewKey, val)
+	o.rename(d.Key, d.NewKey)
+
+	return out, w, nil
+}
+
+// versionReached reports whether the RoadRunner version current is target or a later
+// one. A version that isn't made of numbers, such as local, reaches nothing.
+func versionReached(current, target string) bool {
+	cur, ok := versionParts(current)
+	if !ok {
+		return false
+	}
+
+	tgt, ok := versionParts(target)
+	if !ok {
+		return false
+	}
+
+	for i := range max(len(cur), len(tgt)) {
+		var c, t int
+		if i < len(cur) {
+			c = cur[i]
+		}
+		if i < len(tgt) {
+			t = tgt[i]
+		}
+
+		if c != t {
+			return c > t
+		}
+	}
+
+	return true
+}
+
+func versionParts(version string) ([]int, bool) {
+	version = strings.TrimPrefix(version, "v")
+	// pre-release and build suffixes don't matter here
+	version, _, _ = strings.Cut(version, "-")
+	version, _, _ = strings.Cut(version, "+")
+
+	fields := strings.Split(version, ".")
+	parts := make([]int, 0, len(fields))
+	for _, f := range fields {
+		n, err := strconv.Atoi(f)
+		if err != nil {
+			return nil, false
+		}
+
+		parts = append(parts, n)
+	}
+
+	return parts, true
+}
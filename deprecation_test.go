@@ -0,0 +1,120 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const deprecatedConfig = `version: "3"
+http:
+  address: 127.0.0.1:8080
+  max_request: 100
+  pool:
+    workers: 4
+`
+
+func TestRegisterDeprecationMovesValue(t *testing.T) {
+	p := initFromYAML(t, deprecatedConfig)
+
+	require.NoError(t, p.RegisterDeprecation(Deprecation{
+		Key:       "http.pool.workers",
+		NewKey:    "http.pool.num_workers",
+		RemovedIn: "2025.1.0",
+	}))
+
+	assert.False(t, p.Has("http.pool.workers"))
+	assert.Equal(t, 4, p.Get("http.pool.num_workers"))
+	assert.Equal(t, "127.0.0.1:8080", p.Get("http.address"))
+
+	o, ok := p.Origin("http.pool.num_workers")
+	require.True(t, ok)
+	assert.Equal(t, 6, o.Line)
+
+	assert.Equal(t, []Warning{{
+		Kind:    WarningDeprecatedKey,
+		Message: "key `http.pool.workers` is deprecated, use `http.pool.num_workers` instead",
+		Key:     "http.pool.workers",
+		Fields:  map[string]string{"new_key": "http.pool.num_workers", "removed_in": "2025.1.0"},
+	}}, p.Warnings())
+}
+
+func TestDeprecationNewKeyWins(t *testing.T) {
+	p := initFromYAML(t, deprecatedConfig+"  max_request_size: 200\n")
+
+	require.NoError(t, p.RegisterDeprecation(Deprecation{Key: "http.max_request", NewKey: "http.max_request_size"}))
+
+	assert.Equal(t, 200, p.Get("http.max_request_size"))
+	assert.False(t, p.Has("http.max_request"))
+}
+
+func TestDeprecationWithoutReplacement(t *testing.T) {
+	p := initFromYAML(t, deprecatedConfig)
+
+	require.NoError(t, p.RegisterDeprecation(Deprecation{Key: "http.max_request", Message: "max_request has no effect anymore"}))
+	// a key the configuration doesn't set raises nothing
+	require.NoError(t, p.RegisterDeprecation(Deprecation{Key: "http.uploads.dir", NewKey: "http.uploads.directory"}))
+
+	assert.Equal(t, 100, p.Get("http.max_request"))
+	assert.Equal(t, []Warning{{
+		Kind:    WarningDeprecatedKey,
+		Message: "max_request has no effect anymore",
+		Key:     "http.max_request",
+		Fields:  map[string]string{},
+	}}, p.Warnings())
+}
+
+// TestDeprecationSurvivesReload checks that a registered deprecation is applied to the
+// reloaded configuration, and warns only once.
+func TestDeprecationSurvivesReload(t *testing.T) {
+	path := writeYAML(t, deprecatedConfig)
+	p := &Plugin{Path: path}
+	require.NoError(t, p.Init())
+	require.NoError(t, p.RegisterDeprecation(Deprecation{Key: "http.pool.workers", NewKey: "http.pool.num_workers"}))
+
+	rewrite(t, path, "version: \"3\"\nhttp:\n  pool:\n    workers: 8\n")
+	require.NoError(t, p.Reload())
+
+	assert.Equal(t, 8, p.Get("http.pool.num_workers"))
+	assert.Len(t, p.Warnings(), 1)
+}
+
+func TestStrictDeprecations(t *testing.T) {
+	d := Deprecation{Key: "http.pool.workers", NewKey: "http.pool.num_workers", RemovedIn: "2025.1.0"}
+
+	p := &Plugin{Path: writeYAML(t, deprecatedConfig), StrictDeprecations: true, Version: "2025.2.1"}
+	require.NoError(t, p.Init())
+	require.ErrorContains(t, p.RegisterDeprecation(d), "key `http.pool.workers` was removed in 2025.1.0, use `http.pool.num_workers` instead")
+
+	// before the removal version the key is only deprecated
+	p = &Plugin{Path: writeYAML(t, deprecatedConfig), StrictDeprecations: true, Version: "2024.3.5"}
+	require.NoError(t, p.Init())
+	require.NoError(t, p.RegisterDeprecation(d))
+
+	// and so it is without the strict mode
+	p = &Plugin{Path: writeYAML(t, deprecatedConfig), Version: "2025.2.1"}
+	require.NoError(t, p.Init())
+	require.NoError(t, p.RegisterDeprecation(d))
+}
+
+func TestVersionReached(t *testing.T) {
+	tests := []struct {
+		current, target string
+		want            bool
+	}{
+		{current: "2025.1.0", target: "2025.1.0", want: true},
+		{current: "v2025.1.1", target: "2025.1", want: true},
+		{current: "2025.1.0-rc.1", target: "2025.1.0", want: true},
+		{current: "2024.12.9", target: "2025.1.0"},
+		{current: "local", target: "2025.1.0"},
+		{current: "3", target: "2025.1.0"},
+		{current: "2025.1.0", target: "next"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.current+" "+tt.target, func(t *testing.T) {
+			assert.Equal(t, tt.want, versionReached(tt.current, tt.target))
+		})
+	}
+}
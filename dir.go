@@ -0,0 +1,131 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/roadrunner-server/errors"
+	"github.com/spf13/viper"
+)
+
+// dirName stands for the files of a configuration directory in the include chains, the
+// relative include entries and the envfile are resolved against the directory.
+const dirName string = "<dir>"
+
+// rootSource is a file the root configuration was read from, along with the keys it set.
+// The keys of a single root file are the ones of the whole configuration, nil here.
+type rootSource struct {
+	path string
+	keys []string
+}
+
+// isDir reports whether the path is a directory.
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// dirFiles returns the configuration files of the directory in lexical order, as
+// os.ReadDir sorts them: the files in a format the extension tells, the hidden ones left
+// out, such as the ..data link of a Kubernetes ConfigMap mount. The subdirectories
+// aren't read.
+func dirFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") || formatOf(name) == "" {
+			continue
+		}
+
+		path := filepath.Join(dir, name)
+		// a ConfigMap mounts its files as links, which are followed
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if info.Mode().IsRegular() {
+			files = append(files, path)
+		}
+	}
+
+	return files, nil
+}
+
+// readDir reads the configuration files of the directory at Path, each one deep merged
+// over the ones before it, the lists being combined according to ListMerge. The files
+// declaring a version must declare the same one. Their include entries are all kept, in
+// the order of the files.
+func (p *Plugin) readDir() (*viper.Viper, []rootSource, error) {
+	files, err := dirFiles(p.Path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(files) == 0 {
+		return nil, nil, errors.Errorf("no configuration files in the directory %s, expected yaml, json, toml or hcl files", p.Path)
+	}
+
+	m, err := p.merger()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	settings := make(map[string]any)
+	sources := make([]rootSource, 0, len(files))
+	var includes []any
+	var version any
+	var versionFile string
+
+	for _, file := range files {
+		v, errR := readFile(file, "")
+		if errR != nil {
+			return nil, nil, errR
+		}
+
+		if ver := v.Get(versionKey); ver != nil {
+			if version != nil && !reflect.DeepEqual(ver, version) {
+				return nil, nil, errors.Errorf("version in %s must be the same as in %s", file, versionFile)
+			}
+
+			version, versionFile = ver, file
+		}
+
+		fileSettings := v.AllSettings()
+		switch raw := fileSettings[includeKey].(type) {
+		case nil:
+		case []any:
+			includes = append(includes, raw...)
+		default:
+			includes = append(includes, raw)
+		}
+		delete(fileSettings, includeKey)
+
+		for key, val := range fileSettings {
+			settings[key] = m.merge(settings[key], val)
+		}
+
+		keys := slices.DeleteFunc(v.AllKeys(), func(key string) bool { return key == includeKey })
+		sources = append(sources, rootSource{path: file, keys: keys})
+	}
+
+	if includes != nil {
+		settings[includeKey] = includes
+	}
+
+	v := viper.New()
+	err = v.MergeConfigMap(settings)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return v, sources, nil
+}
@@ -0,0 +1,145 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDirMergesFilesInLexicalOrder(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "00-base.yaml", `version: "3"
+rpc:
+  listen: tcp://127.0.0.1:6391
+http:
+  address: 127.0.0.1:8080
+  pool:
+    num_workers: 2
+    debug: true
+`)
+	writeFile(t, dir, "10-http.json", `{"http": {"pool": {"num_workers": 4}}}`)
+	writeFile(t, dir, "20-kv.toml", "[kv.local]\ndriver = \"memory\"\n")
+
+	p := &Plugin{Path: dir}
+	require.NoError(t, p.Init())
+
+	assert.Equal(t, "tcp://127.0.0.1:6391", p.Get("rpc.listen"))
+	assert.Equal(t, "127.0.0.1:8080", p.Get("http.address"))
+	assert.Equal(t, 4, p.viper.GetInt("http.pool.num_workers"))
+	assert.Equal(t, true, p.Get("http.pool.debug"))
+	assert.Equal(t, "memory", p.Get("kv.local.driver"))
+
+	o, ok := p.Origin("http.pool.num_workers")
+	require.True(t, ok)
+	assert.Equal(t, LayerFile, o.Layer)
+	assert.Equal(t, filepath.Join(dir, "10-http.json"), o.File)
+
+	o, ok = p.Origin("http.address")
+	require.True(t, ok)
+	assert.Equal(t, filepath.Join(dir, "00-base.yaml"), o.File)
+	assert.Equal(t, 5, o.Line)
+}
+
+func TestDirListMerge(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "a.yaml", "version: \"3\"\nhttp:\n  middleware: [gzip]\n")
+	writeFile(t, dir, "b.yaml", "http:\n  middleware: [headers]\n")
+
+	p := &Plugin{Path: dir}
+	require.NoError(t, p.Init())
+	assert.Equal(t, []string{"headers"}, p.Get("http.middleware"))
+
+	p = &Plugin{Path: dir, ListMerge: ListAppend}
+	require.NoError(t, p.Init())
+	assert.Equal(t, []string{"gzip", "headers"}, p.Get("http.middleware"))
+}
+
+func TestDirSkipsHiddenAndUnknownFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "rr.yaml", rpcConfig)
+	writeFile(t, dir, ".hidden.yaml", "rpc:\n  listen: tcp://127.0.0.1:6400\n")
+	writeFile(t, dir, "README.md", "# not a configuration\n")
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "nested"), 0o700))
+	writeFile(t, filepath.Join(dir, "nested"), "rpc.yaml", "rpc:\n  listen: tcp://127.0.0.1:6401\n")
+
+	p := &Plugin{Path: dir}
+	require.NoError(t, p.Init())
+	assert.Equal(t, "tcp://127.0.0.1:6391", p.Get("rpc.listen"))
+}
+
+// TestDirConfigMapLayout covers the layout Kubernetes mounts a ConfigMap with: the files
+// are links into a hidden ..data directory, itself a link to the current revision.
+func TestDirConfigMapLayout(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "..2026_10_17_00_00_00.000000000"), 0o700))
+	writeFile(t, filepath.Join(dir, "..2026_10_17_00_00_00.000000000"), "rr.yaml", rpcConfig)
+	require.NoError(t, os.Symlink("..2026_10_17_00_00_00.000000000", filepath.Join(dir, "..data")))
+	require.NoError(t, os.Symlink(filepath.Join("..data", "rr.yaml"), filepath.Join(dir, "rr.yaml")))
+
+	p := &Plugin{Path: dir}
+	require.NoError(t, p.Init())
+	assert.Equal(t, "tcp://127.0.0.1:6391", p.Get("rpc.listen"))
+}
+
+func TestDirVersion(t *testing.T) {
+	t.Run("mismatch", func(t *testing.T) {
+		dir := t.TempDir()
+		writeFile(t, dir, "a.yaml", rpcConfig)
+		writeFile(t, dir, "b.yaml", "version: \"2.7\"\nhttp:\n  address: 127.0.0.1:8080\n")
+
+		p := &Plugin{Path: dir}
+		assert.ErrorContains(t, p.Init(), "version in "+filepath.Join(dir, "b.yaml")+" must be the same as in "+filepath.Join(dir, "a.yaml"))
+	})
+
+	t.Run("missing everywhere", func(t *testing.T) {
+		dir := t.TempDir()
+		writeFile(t, dir, "a.yaml", "rpc:\n  listen: tcp://127.0.0.1:6391\n")
+
+		p := &Plugin{Path: dir}
+		assert.ErrorContains(t, p.Init(), "should contain a version")
+	})
+}
+
+func TestDirWithoutConfigFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "README.md", "# not a configuration\n")
+
+	p := &Plugin{Path: dir}
+	assert.ErrorContains(t, p.Init(), "no configuration files in the directory")
+}
+
+func TestDirIncludesAndEnvFile(t *testing.T) {
+	restoreEnv(t, "CONFIG_TEST_DIR_ADDRESS")
+
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "extra"), 0o700))
+	writeFile(t, filepath.Join(dir, "extra"), "http.yaml", "version: \"3\"\nhttp:\n  address: ${CONFIG_TEST_DIR_ADDRESS}\n")
+	writeFile(t, filepath.Join(dir, "extra"), "kv.yaml", "version: \"3\"\nkv:\n  local:\n    driver: memory\n")
+	writeFile(t, filepath.Join(dir, "extra"), ".env", "CONFIG_TEST_DIR_ADDRESS=127.0.0.1:8080\n")
+	writeFile(t, dir, "a.yaml", "version: \"3\"\nenvfile: extra/.env\ninclude: [extra/http.yaml]\n")
+	writeFile(t, dir, "b.yaml", "include: [extra/kv.yaml]\n")
+
+	p := &Plugin{Path: dir}
+	require.NoError(t, p.Init())
+
+	assert.Equal(t, "127.0.0.1:8080", p.Get("http.address"))
+	assert.Equal(t, "memory", p.Get("kv.local.driver"))
+}
+
+func TestDirReloadPicksUpNewFile(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "a.yaml", rpcConfig)
+
+	p := &Plugin{Path: dir}
+	require.NoError(t, p.Init())
+	assert.False(t, p.Has("http"))
+
+	added := writeFile(t, dir, "b.yaml", "http:\n  address: 127.0.0.1:8080\n")
+	assert.True(t, p.isWatched(added))
+
+	require.NoError(t, p.Reload())
+	assert.Equal(t, "127.0.0.1:8080", p.Get("http.address"))
+}
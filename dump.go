@@ -0,0 +1,115 @@
+package config
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/roadrunner-server/errors"
+	"go.yaml.in/yaml/v3"
+)
+
+const (
+	// FormatYAML dumps the configuration as YAML.
+	FormatYAML string = "yaml"
+	// FormatJSON dumps the configuration as indented JSON.
+	FormatJSON string = "json"
+
+	// redactedValue replaces the values of the sensitive keys in a dump.
+	redactedValue string = "******"
+)
+
+// defaultRedact is used when Plugin.Redact is nil.
+var defaultRedact = []string{"password", "secret", "token", "dsn"}
+
+// Dump writes the effective configuration, the one plugins see through Get and
+// Unmarshal, to w in the given format. The values of the keys matching the Redact
+// patterns are masked, a whole section is masked when its own name matches.
+func (p *Plugin) Dump(w io.Writer, format string) error {
+	const op = errors.Op("config_plugin_dump")
+
+	p.mu.RLock()
+	settings := redact(p.viper.AllSettings(), p.redactPatterns())
+	p.mu.RUnlock()
+
+	var data []byte
+	var err error
+	switch strings.ToLower(format) {
+	case FormatYAML, "yml", "":
+		data, err = yaml.Marshal(settings)
+	case FormatJSON:
+		data, err = json.MarshalIndent(settings, "", "  ")
+		data = append(data, '\n')
+	default:
+		return errors.E(op, errors.Errorf("unknown dump format `%s`, supported formats are: yaml, json", format))
+	}
+
+	if err != nil {
+		return errors.E(op, err)
+	}
+
+	_, err = w.Write(data)
+	if err != nil {
+		return errors.E(op, err)
+	}
+
+	return nil
+}
+
+func (p *Plugin) redactPatterns() []string {
+	if p.Redact == nil {
+		return defaultRedact
+	}
+
+	return p.Redact
+}
+
+// redact returns a copy of the settings with the values of the sensitive keys masked.
+// A pattern matches a key when the key contains it, regardless of the case.
+func redact(settings map[string]any, patterns []string) map[string]any {
+	out := make(map[string]any, len(settings))
+	for key, val := range settings {
+		if sensitive(key, patterns) {
+			out[key] = redactedValue
+			continue
+		}
+
+		switch t := val.(type) {
+		case map[string]any:
+			out[key] = redact(t, patterns)
+		case []any:
+			out[key] = redactSlice(t, patterns)
+		default:
+			out[key] = val
+		}
+	}
+
+	return out
+}
+
+// redactSlice masks the sensitive keys of the sections found in a list, such as the
+// list of the jobs pipelines.
+func redactSlice(items []any, patterns []string) []any {
+	out := make([]any, len(items))
+	for i, item := range items {
+		if m, ok := item.(map[string]any); ok {
+			out[i] = redact(m, patterns)
+			continue
+		}
+
+		out[i] = item
+	}
+
+	return out
+}
+
+func sensitive(key string, patterns []string) bool {
+	key = strings.ToLower(key)
+	for _, p := range patterns {
+		if p != "" && strings.Contains(key, strings.ToLower(p)) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,155 @@
+package config
+
+import (
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/roadrunner-server/errors"
+)
+
+// envKeySeparator separates the key parts in the name of a bound env variable, a single
+// underscore stays a part of the key: RR_HTTP__POOL__NUM_WORKERS is http.pool.num_workers.
+const envKeySeparator string = "__"
+
+// EnvBinding is an env variable applied to a configuration key through EnvPrefix.
+type EnvBinding struct {
+	// Var is the name of the env variable.
+	Var string
+	// Key is the configuration key it set.
+	Key string
+}
+
+// EnvBindings returns the env variables applied through EnvPrefix, sorted by name.
+func (p *Plugin) EnvBindings() []EnvBinding {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return slices.Clone(p.envBindings)
+}
+
+// envKey returns the configuration key the env variable binds to, if it carries the
+// prefix and names a key the plugins read.
+func envKey(prefix, name string) (string, bool) {
+	rest, ok := strings.CutPrefix(name, prefix+"_")
+	if !ok || rest == "" || name == envProfile {
+		return "", false
+	}
+
+	parts := strings.Split(strings.ToLower(rest), envKeySeparator)
+	if slices.Contains(parts, "") {
+		return "", false
+	}
+
+	// the keys the loader consumes are long gone by the time the variables apply, and
+	// RR_VERSION commonly holds the version of the binary
+	key := strings.Join(parts, ".")
+	if isLoaderKey(key) || key == envFileKey {
+		return "", false
+	}
+
+	return key, true
+}
+
+// bindEnv applies the env variables carrying EnvPrefix to the configuration. A variable
+// naming a section is left alone, a section can't be replaced from the environment.
+func (p *Plugin) bindEnv(snap *snapshot) error {
+	if p.EnvPrefix == "" {
+		return nil
+	}
+
+	environ := os.Environ()
+	slices.Sort(environ)
+
+	for _, kv := range environ {
+		name, val, _ := strings.Cut(kv, "=")
+		key, ok := envKey(p.EnvPrefix, name)
+		if !ok {
+			continue
+		}
+
+		current := snap.viper.Get(key)
+		if _, section := current.(map[string]any); section {
+			snap.warnings = append(snap.warnings, Warning{
+				Kind:    WarningUnusedEnv,
+				Message: "the env variable names a section, which can't be replaced from the environment, it's ignored",
+				Key:     key,
+				Fields:  map[string]string{"env": name},
+			})
+			continue
+		}
+
+		typed, err := coerceEnv(current, val)
+		if err != nil {
+			return errors.Errorf("env variable %s can't be applied to %s: %v", name, key, err)
+		}
+
+		snap.viper.Set(key, typed)
+		snap.origins.set(key, Origin{Layer: LayerEnv, Env: []string{name}})
+		snap.envBindings = append(snap.envBindings, EnvBinding{Var: name, Key: key})
+	}
+
+	return nil
+}
+
+// coerceEnv converts the value of an env variable to the type of the value it replaces:
+// a list is given as comma separated items. A key the configuration lacks gets a
+// boolean, a number or a string, whichever the value reads as.
+func coerceEnv(current any, val string) (any, error) {
+	switch current.(type) {
+	case nil:
+		return inferScalar(val), nil
+	case bool:
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return nil, errors.Errorf("expected a boolean, got `%s`", val)
+		}
+		return b, nil
+	case int, int64:
+		i, err := strconv.Atoi(val)
+		if err != nil {
+			return nil, errors.Errorf("expected an integer, got `%s`", val)
+		}
+		return i, nil
+	case float64:
+		f, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return nil, errors.Errorf("expected a number, got `%s`", val)
+		}
+		return f, nil
+	case []any, []string:
+		if val == "" {
+			return []string{}, nil
+		}
+
+		items := strings.Split(val, ",")
+		for i := range items {
+			items[i] = strings.TrimSpace(items[i])
+		}
+		return items, nil
+	default:
+		return val, nil
+	}
+}
+
+// inferScalar reads a value with no type to follow. Only the plain numbers are taken as
+// numbers, not Inf or NaN.
+func inferScalar(val string) any {
+	switch val {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+
+	if i, err := strconv.Atoi(val); err == nil {
+		return i
+	}
+
+	if f, err := strconv.ParseFloat(val, 64); err == nil && strings.ContainsAny(val, "0123456789") {
+		return f
+	}
+
+	return val
+}
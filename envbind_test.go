@@ -0,0 +1,157 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const envBindConfig = `version: "3"
+http:
+  address: 127.0.0.1:8080
+  middleware: [gzip]
+  pool:
+    num_workers: 2
+    debug: false
+    ratio: 0.5
+`
+
+func TestEnvBinding(t *testing.T) {
+	t.Setenv("CFGTEST_HTTP__POOL__NUM_WORKERS", "8")
+	t.Setenv("CFGTEST_HTTP__POOL__DEBUG", "true")
+	t.Setenv("CFGTEST_HTTP__POOL__RATIO", "0.75")
+	t.Setenv("CFGTEST_HTTP__MIDDLEWARE", "headers, gzip")
+	t.Setenv("CFGTEST_HTTP__POOL__MAX_JOBS", "100")
+	t.Setenv("CFGTEST_HTTP__ADDRESS", "0.0.0.0:80")
+	// a section can't be replaced from the environment
+	t.Setenv("CFGTEST_HTTP", "plain")
+
+	p := &Plugin{Path: writeYAML(t, envBindConfig), EnvPrefix: "CFGTEST"}
+	require.NoError(t, p.Init())
+
+	assert.Equal(t, 8, p.Get("http.pool.num_workers"))
+	assert.Equal(t, true, p.Get("http.pool.debug"))
+	assert.Equal(t, 0.75, p.Get("http.pool.ratio"))
+	assert.Equal(t, []string{"headers", "gzip"}, p.Get("http.middleware"))
+	assert.Equal(t, 100, p.Get("http.pool.max_jobs"))
+	assert.Equal(t, "0.0.0.0:80", p.Get("http.address"))
+
+	var out struct {
+		Pool struct {
+			NumWorkers int `mapstructure:"num_workers"`
+		} `mapstructure:"pool"`
+	}
+	require.NoError(t, p.UnmarshalKey("http", &out))
+	assert.Equal(t, 8, out.Pool.NumWorkers)
+
+	assert.Equal(t, []EnvBinding{
+		{Var: "CFGTEST_HTTP__ADDRESS", Key: "http.address"},
+		{Var: "CFGTEST_HTTP__MIDDLEWARE", Key: "http.middleware"},
+		{Var: "CFGTEST_HTTP__POOL__DEBUG", Key: "http.pool.debug"},
+		{Var: "CFGTEST_HTTP__POOL__MAX_JOBS", Key: "http.pool.max_jobs"},
+		{Var: "CFGTEST_HTTP__POOL__NUM_WORKERS", Key: "http.pool.num_workers"},
+		{Var: "CFGTEST_HTTP__POOL__RATIO", Key: "http.pool.ratio"},
+	}, p.EnvBindings())
+
+	o, ok := p.Origin("http.pool.num_workers")
+	require.True(t, ok)
+	assert.Equal(t, Origin{Layer: LayerEnv, Env: []string{"CFGTEST_HTTP__POOL__NUM_WORKERS"}}, o)
+}
+
+func TestEnvBindingIsOptIn(t *testing.T) {
+	t.Setenv("RR_HTTP__POOL__NUM_WORKERS", "8")
+
+	p := initFromYAML(t, envBindConfig)
+
+	assert.Equal(t, 2, p.Get("http.pool.num_workers"))
+	assert.Empty(t, p.EnvBindings())
+}
+
+// TestEnvBindingLayer checks that the bound env variables override the file, and are
+// overridden by the Flags.
+func TestEnvBindingLayer(t *testing.T) {
+	t.Setenv("CFGTEST_HTTP__POOL__NUM_WORKERS", "8")
+	t.Setenv("CFGTEST_HTTP__ADDRESS", "0.0.0.0:80")
+
+	p := &Plugin{
+		Path:      writeYAML(t, envBindConfig),
+		EnvPrefix: "CFGTEST",
+		Flags:     []string{"http.address=0.0.0.0:443"},
+	}
+	require.NoError(t, p.Init())
+
+	assert.Equal(t, 8, p.Get("http.pool.num_workers"))
+	assert.Equal(t, "0.0.0.0:443", p.Get("http.address"))
+}
+
+// TestEnvBindingOverridesIncludes checks that the bound env variables override the
+// included files as they do the root, and that EnvBindings reports what applied.
+func TestEnvBindingOverridesIncludes(t *testing.T) {
+	t.Setenv("CFGTEST_HTTP__POOL__NUM_WORKERS", "8")
+
+	dir := t.TempDir()
+	sub := writeFile(t, dir, "http.yaml", "version: \"3\"\nhttp:\n  pool:\n    num_workers: 2\n")
+
+	p := &Plugin{Path: rootWithIncludes(t, dir, rpcConfigBody, sub), EnvPrefix: "CFGTEST"}
+	require.NoError(t, p.Init())
+
+	assert.Equal(t, 8, p.Get("http.pool.num_workers"))
+	assert.Equal(t, []EnvBinding{{Var: "CFGTEST_HTTP__POOL__NUM_WORKERS", Key: "http.pool.num_workers"}}, p.EnvBindings())
+
+	o, ok := p.Origin("http.pool.num_workers")
+	require.True(t, ok)
+	assert.Equal(t, LayerEnv, o.Layer)
+}
+
+func TestEnvBindingSkipsLoaderKeys(t *testing.T) {
+	t.Setenv("CFGTEST_VERSION", "2024.3.0")
+
+	p := &Plugin{Path: writeYAML(t, envBindConfig), EnvPrefix: "CFGTEST"}
+	require.NoError(t, p.Init())
+
+	assert.Equal(t, "3", p.Get("version"))
+	assert.Empty(t, p.EnvBindings())
+}
+
+func TestEnvBindingTypeMismatch(t *testing.T) {
+	t.Setenv("CFGTEST_HTTP__POOL__NUM_WORKERS", "many")
+
+	p := &Plugin{Path: writeYAML(t, envBindConfig), EnvPrefix: "CFGTEST"}
+
+	require.ErrorContains(t, p.Init(), "env variable CFGTEST_HTTP__POOL__NUM_WORKERS can't be applied to http.pool.num_workers: expected an integer, got `many`")
+}
+
+func TestEnvKey(t *testing.T) {
+	tests := []struct {
+		name string
+		key  string
+		ok   bool
+	}{
+		{name: "RR_HTTP__POOL__NUM_WORKERS", key: "http.pool.num_workers", ok: true},
+		{name: "RR_VERSION"},
+		{name: "RR_INCLUDE"},
+		{name: "RR_ENVFILE"},
+		{name: "RR_PROFILE"},
+		{name: "RR_"},
+		{name: "RR_HTTP____POOL"},
+		{name: "RRHTTP"},
+		{name: "HTTP__POOL"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, ok := envKey("RR", tt.name)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.key, key)
+		})
+	}
+}
+
+func TestInferScalar(t *testing.T) {
+	assert.Equal(t, true, inferScalar("true"))
+	assert.Equal(t, 42, inferScalar("42"))
+	assert.Equal(t, 1.5, inferScalar("1.5"))
+	assert.Equal(t, "Inf", inferScalar("Inf"))
+	assert.Equal(t, "127.0.0.1:80", inferScalar("127.0.0.1:80"))
+}
@@ -1,61 +1,252 @@
 package config
 
 import (
+	"maps"
+	"os"
+	"slices"
 	"strings"
 
+	"github.com/roadrunner-server/errors"
 	"github.com/spf13/viper"
 )
 
 // ExpandVal replaces ${var} or $var in the string based on the mapping function.
 // For example, os.ExpandEnv(s) is equivalent to os.Expand(s, os.Getenv).
+//
+// The POSIX parameter expansions are supported, a variable the mapping returns an
+// empty string for is treated as unset:
+//
+//	${var:-word} ${var-word} use word when var is unset (or empty, with the colon)
+//	${var:=word} ${var=word} same, and var keeps word for the rest of s
+//	${var:?word} ${var?word} fail with word as the message
+//	${var:+word} ${var+word} use word when var is set (and not empty, with the colon)
+//
+// The word is expanded in turn, so the defaults nest: ${A:-${B:-x}}. $$ stands for a
+// literal dollar sign. A failed ${var:?word} makes the whole result empty.
 func ExpandVal(s string, mapping func(string) string) string {
+	failed := false
+	e := &expander{
+		lookup: func(name string) (string, bool) {
+			val := mapping(name)
+			return val, val != ""
+		},
+		required: func(string, string) {
+			failed = true
+		},
+	}
+
+	out := e.expand(s)
+	if failed {
+		return ""
+	}
+
+	return out
+}
+
+// expander expands the parameters of a single value.
+type expander struct {
+	lookup func(name string) (string, bool)
+	// unset, when set, is called for a plain $var or ${var} reference to an unset variable
+	unset func(name string)
+	// required is called for a ${var:?word} reference to an unset variable, with the
+	// expanded word as the message, which may be empty
+	required func(name, msg string)
+	// assigned holds the values given by ${var:=word}, they shadow lookup
+	assigned map[string]string
+}
+
+func (e *expander) get(name string) (string, bool) {
+	if val, ok := e.assigned[name]; ok {
+		return val, true
+	}
+
+	return e.lookup(name)
+}
+
+// getPlain looks up a reference that carries no operator.
+func (e *expander) getPlain(name string) string {
+	val, set := e.get(name)
+	if !set && e.unset != nil {
+		e.unset(name)
+	}
+
+	return val
+}
+
+func (e *expander) expand(s string) string {
 	var buf []byte
 	// ${} is all ASCII, so bytes are fine for this operation.
 	i := 0
 	for j := 0; j < len(s); j++ {
-		if s[j] == '$' && j+1 < len(s) {
-			if buf == nil {
-				buf = make([]byte, 0, 2*len(s))
+		if s[j] != '$' || j+1 >= len(s) {
+			continue
+		}
+
+		if buf == nil {
+			buf = make([]byte, 0, 2*len(s))
+		}
+		buf = append(buf, s[i:j]...)
+
+		switch s[j+1] {
+		case '$':
+			// $$ is an escaped dollar
+			buf = append(buf, '$')
+			j++
+		case '{':
+			end := closingBrace(s, j+2)
+			if end < 0 {
+				// Bad syntax; eat "${"
+				j++
+				break
 			}
-			buf = append(buf, s[i:j]...)
+
+			buf = append(buf, e.param(s[j+2:end])...)
+			j = end
+		default:
 			name, w := getShellName(s[j+1:])
-			if name == "" && w > 0 { //nolint:revive
-				// Encountered invalid syntax; eat the
-				// characters.
-			} else if name == "" {
+			if name == "" {
 				// Valid syntax, but $ was not followed by a
 				// name. Leave the dollar character untouched.
 				buf = append(buf, s[j])
-				// parse default syntax
-			} else if found := strings.Contains(s, envDefault); found {
-				// ${key:=default} or ${key:-val}
-				substr := strings.Split(name, envDefault)
-				if len(substr) != 2 {
-					return ""
-				}
-
-				key := substr[0]
-				defaultVal := substr[1]
-
-				res := mapping(key)
-				if res == "" {
-					res = defaultVal
-				}
-
-				buf = append(buf, res...)
 			} else {
-				buf = append(buf, mapping(name)...)
+				buf = append(buf, e.getPlain(name)...)
 			}
 			j += w
-			i = j + 1
 		}
+
+		i = j + 1
 	}
+
 	if buf == nil {
 		return s
 	}
+
 	return string(buf) + s[i:]
 }
 
+// references returns the spans of the env references in s, found the way expand finds
+// them: an escaped dollar, or a $ followed by no name, isn't one.
+func references(s string) [][2]int {
+	var spans [][2]int
+	for j := 0; j < len(s); j++ {
+		if s[j] != '$' || j+1 >= len(s) {
+			continue
+		}
+
+		switch s[j+1] {
+		case '$':
+			j++
+		case '{':
+			end := closingBrace(s, j+2)
+			if end < 0 {
+				j++
+				break
+			}
+
+			spans = append(spans, [2]int{j, end + 1})
+			j = end
+		default:
+			name, w := getShellName(s[j+1:])
+			if name != "" {
+				spans = append(spans, [2]int{j, j + 1 + w})
+			}
+			j += w
+		}
+	}
+
+	return spans
+}
+
+// param expands the body of a ${...} expression. A body that isn't a valid expansion
+// expands to nothing.
+func (e *expander) param(body string) string {
+	if body == "" || body[0] == '{' {
+		return ""
+	}
+
+	name, w := getShellName(body)
+	if name == "" {
+		return ""
+	}
+
+	op := body[w:]
+	if op == "" {
+		return e.getPlain(name)
+	}
+
+	// with the colon, an empty value counts as unset
+	colon := op[0] == ':'
+	if colon {
+		op = op[1:]
+	}
+
+	if op == "" {
+		return ""
+	}
+
+	val, set := e.get(name)
+	unset := !set || colon && val == ""
+	word := op[1:]
+
+	switch op[0] {
+	case '-':
+		if unset {
+			return e.expand(word)
+		}
+	case '=':
+		if unset {
+			res := e.expand(word)
+			if e.assigned == nil {
+				e.assigned = make(map[string]string)
+			}
+			e.assigned[name] = res
+
+			return res
+		}
+	case '?':
+		if unset {
+			msg := e.expand(word)
+			if e.required != nil {
+				e.required(name, msg)
+			}
+
+			return ""
+		}
+	case '+':
+		if unset {
+			return ""
+		}
+
+		return e.expand(word)
+	default:
+		return ""
+	}
+
+	return val
+}
+
+// closingBrace returns the index of the brace closing the expression whose body starts
+// at start, skipping the expressions nested in it, or -1 when there's none.
+func closingBrace(s string, start int) int {
+	depth := 0
+	for k := start; k < len(s); k++ {
+		switch {
+		case s[k] == '$' && k+1 < len(s) && (s[k+1] == '{' || s[k+1] == '$'):
+			if s[k+1] == '{' {
+				depth++
+			}
+			k++
+		case s[k] == '}':
+			if depth == 0 {
+				return k
+			}
+			depth--
+		}
+	}
+
+	return -1
+}
+
 // getShellName returns the name that begins the string and the number of bytes
 // consumed to extract it. If the name is enclosed in {}, it's part of a ${}
 // expansion and two more bytes are needed than the length of the name.
@@ -86,19 +277,28 @@ func getShellName(s string) (string, int) {
 	return s[:i], i
 }
 
-func expandEnvViper(v *viper.Viper) {
+// expandEnvViper expands the env references in every value and returns, per key, the
+// names of the variables referenced by its value.
+func expandEnvViper(v *viper.Viper, env *envRefs) map[string][]string {
+	refs := make(map[string][]string)
 	for _, key := range v.AllKeys() {
 		val := v.Get(key)
 		switch t := val.(type) {
 		case string:
 			// for string expand it
-			v.Set(key, parseEnvDefault(t))
+			expanded, names := env.expand(key, t)
+			v.Set(key, expanded)
+			if len(names) > 0 {
+				refs[key] = names
+			}
 		case []any:
 			// for slice -> check if it's a slice of strings
 			strArr := make([]string, 0, len(t))
 			for i := range t {
 				if valStr, ok := t[i].(string); ok {
-					strArr = append(strArr, parseEnvDefault(valStr))
+					expanded, names := env.expand(key, valStr)
+					strArr = append(strArr, expanded)
+					refs[key] = append(refs[key], names...)
 					continue
 				}
 
@@ -109,10 +309,100 @@ func expandEnvViper(v *viper.Viper) {
 			if len(strArr) > 0 {
 				v.Set(key, strArr)
 			}
+
+			if len(refs[key]) == 0 {
+				delete(refs, key)
+			}
 		default:
 			v.Set(key, val)
 		}
 	}
+
+	return refs
+}
+
+// envRefs expands the env references of the configuration values against the process
+// environment. Rather than failing on the first undefined variable, it collects them
+// all, along with the keys referencing them, so they can be reported at once.
+type envRefs struct {
+	// strict makes a plain $var or ${var} reference to an unset variable an error, the
+	// way ${var:?} is
+	strict bool
+	// undefined maps the names of the undefined variables to the keys referencing them
+	undefined map[string]*undefinedEnv
+}
+
+type undefinedEnv struct {
+	msg  string
+	keys []string
+}
+
+// expand expands the value of the key and returns the names of the variables it looked
+// up, set or not.
+func (r *envRefs) expand(key, val string) (string, []string) {
+	// tcp://127.0.0.1:${RPC_PORT:-36643}
+	// for envs like this, part would be tcp://127.0.0.1:
+	var names []string
+	e := &expander{
+		lookup: func(name string) (string, bool) {
+			names = append(names, name)
+			return os.LookupEnv(name)
+		},
+		required: func(name, msg string) {
+			r.add(name, msg, key)
+		},
+	}
+
+	if r.strict {
+		e.unset = func(name string) {
+			r.add(name, "", key)
+		}
+	}
+
+	return e.expand(val), names
+}
+
+func (r *envRefs) add(name, msg, key string) {
+	if r.undefined == nil {
+		r.undefined = make(map[string]*undefinedEnv)
+	}
+
+	u, ok := r.undefined[name]
+	if !ok {
+		u = &undefinedEnv{}
+		r.undefined[name] = u
+	}
+
+	if u.msg == "" {
+		u.msg = msg
+	}
+
+	if !slices.Contains(u.keys, key) {
+		u.keys = append(u.keys, key)
+	}
+}
+
+// err reports every undefined variable with the keys referencing it, sorted by name.
+func (r *envRefs) err() error {
+	if len(r.undefined) == 0 {
+		return nil
+	}
+
+	names := slices.Sorted(maps.Keys(r.undefined))
+	lines := make([]string, 0, len(names))
+	for _, name := range names {
+		u := r.undefined[name]
+		slices.Sort(u.keys)
+
+		line := "\t" + name
+		if u.msg != "" {
+			line += " (" + u.msg + ")"
+		}
+
+		lines = append(lines, line+", referenced by: "+strings.Join(u.keys, ", "))
+	}
+
+	return errors.Errorf("undefined environment variables:\n%s", strings.Join(lines, "\n"))
 }
 
 // isShellSpecialVar reports whether the character identifies a special
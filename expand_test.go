@@ -36,12 +36,29 @@ func TestExpandVal(t *testing.T) {
 		{name: "default inside a larger value", input: "tcp://h:${PORT:-1}", want: "tcp://h:9000"},
 		{name: "two defaults in one value", input: "${SCHEME:-tcp}://127.0.0.1:${RPC_PORT:-36643}", want: "tcp://127.0.0.1:36643"},
 		{name: "two defaults where one name resolves", input: "${SCHEME:-tcp}://127.0.0.1:${PORT:-36643}", want: "tcp://127.0.0.1:9000"},
-		// Only ":-" separates a name from its default, so a bare colon stays part of
-		// the name and the lookup finds nothing.
-		{name: "colon without a dash is part of the name", input: "${SET:val}", want: ""},
-		// A name carrying more than one ":-" splits into three parts and collapses
-		// the whole value to an empty string.
-		{name: "malformed default", input: "${A:-B:-C}", want: ""},
+		// A colon followed by anything but an operator is not a valid expansion, and
+		// expands to nothing.
+		{name: "colon without an operator", input: "${SET:val}", want: ""},
+		{name: "trailing colon", input: "a${SET:}b", want: "ab"},
+		// Only the first operator counts, the rest belongs to the default.
+		{name: "default holding an operator", input: "${A:-B:-C}", want: "B:-C"},
+		{name: "dash default applies to an unset name", input: "${MISSING-def}", want: "def"},
+		{name: "nested default", input: "${A:-${B:-x}}", want: "x"},
+		{name: "nested default resolving", input: "${A:-${PORT:-x}}/p", want: "9000/p"},
+		{name: "nested default not evaluated", input: "${SET:-${A:-x}}", want: "val"},
+		{name: "assign default", input: "${MISSING:=def}", want: "def"},
+		{name: "assigned default is reused", input: "${MISSING:=def}-$MISSING-${MISSING}", want: "def-def-def"},
+		{name: "assign keeps a set value", input: "${SET:=def}", want: "val"},
+		{name: "alternative for a set name", input: "${SET:+alt}", want: "alt"},
+		{name: "alternative for an unset name", input: "x${MISSING:+alt}y", want: "xy"},
+		{name: "alternative is expanded", input: "${SET:+$PORT}", want: "9000"},
+		{name: "required name is set", input: "${SET:?missing}", want: "val"},
+		// A failed required reference empties the whole value.
+		{name: "required name is unset", input: "a ${MISSING:?missing} b", want: ""},
+		{name: "escaped dollar", input: "cost $$5", want: "cost $5"},
+		{name: "escaped dollar before a name", input: "$$SET", want: "$SET"},
+		{name: "escaped dollar inside a default", input: "${MISSING:-$$x}", want: "$x"},
+		{name: "brace in a default", input: "${MISSING:-a}b}", want: "ab}"},
 	}
 
 	for _, tt := range tests {
@@ -51,15 +68,90 @@ func TestExpandVal(t *testing.T) {
 	}
 }
 
-// TestExpandValDefaultScope pins the scope of the ":-" check: it is made against
-// the whole value, so a single default reference turns every other reference in
-// that value into a malformed one and the result collapses to an empty string.
+// TestExpandValDefaultScope pins the scope of a default: it applies to its own
+// reference, the other references of the value are expanded independently.
 func TestExpandValDefaultScope(t *testing.T) {
 	mapping := func(name string) string {
 		return map[string]string{"SET": "val"}[name]
 	}
 
-	assert.Empty(t, ExpandVal("x${SET}y ${MISSING:-d}", mapping))
+	assert.Equal(t, "xvaly d", ExpandVal("x${SET}y ${MISSING:-d}", mapping))
+}
+
+// TestExpandSetAndEmpty covers the difference the colon makes: without it, only an
+// unset variable takes the word, an empty one keeps its empty value.
+func TestExpandSetAndEmpty(t *testing.T) {
+	lookup := func(name string) (string, bool) {
+		return "", name == "EMPTY"
+	}
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{input: "${EMPTY-def}", want: ""},
+		{input: "${EMPTY:-def}", want: "def"},
+		{input: "${EMPTY=def}", want: ""},
+		{input: "${EMPTY:=def}", want: "def"},
+		{input: "${EMPTY+alt}", want: "alt"},
+		{input: "${EMPTY:+alt}", want: ""},
+		{input: "${EMPTY?msg}", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			// a fresh expander, so no assignment leaks from one case to the next
+			e := &expander{lookup: lookup}
+			assert.Equal(t, tt.want, e.expand(tt.input))
+		})
+	}
+}
+
+func TestExpandRequiredMessages(t *testing.T) {
+	type required struct{ name, msg string }
+	var got []required
+
+	e := &expander{
+		lookup: func(name string) (string, bool) {
+			return map[string]string{"EMPTY": "", "PORT": "9000"}[name], name == "EMPTY" || name == "PORT"
+		},
+		required: func(name, msg string) {
+			got = append(got, required{name: name, msg: msg})
+		},
+	}
+
+	// Every failed reference of the value is reported, the message is expanded.
+	out := e.expand("${MISSING:?MISSING must point to the database} ${EMPTY:?} ${OTHER?next to port $PORT} ${PORT:?}")
+	assert.Equal(t, "   9000", out)
+	assert.Equal(t, []required{
+		{name: "MISSING", msg: "MISSING must point to the database"},
+		{name: "EMPTY", msg: ""},
+		{name: "OTHER", msg: "next to port 9000"},
+	}, got)
+}
+
+func TestEnvRefsCollectsUndefined(t *testing.T) {
+	t.Setenv("CONFIG_TEST_REFS_SET", "set")
+
+	env := &envRefs{}
+	out, names := env.expand("rpc.listen", "$CONFIG_TEST_REFS_SET/${CONFIG_TEST_REFS_PLAIN}/${CONFIG_TEST_REFS_REQUIRED:?required}")
+	assert.Equal(t, "set//", out)
+	assert.Equal(t, []string{"CONFIG_TEST_REFS_SET", "CONFIG_TEST_REFS_PLAIN", "CONFIG_TEST_REFS_REQUIRED"}, names)
+
+	_, _ = env.expand("http.address", "${CONFIG_TEST_REFS_REQUIRED:?}")
+	// Without the strict mode, a plain reference to an unset variable is not an error.
+	require.EqualError(t, env.err(), `undefined environment variables:
+	CONFIG_TEST_REFS_REQUIRED (required), referenced by: http.address, rpc.listen`)
+
+	strict := &envRefs{strict: true}
+	_, _ = strict.expand("rpc.listen", "${CONFIG_TEST_REFS_PLAIN}:$CONFIG_TEST_REFS_OTHER")
+	_, _ = strict.expand("logs.level", "${CONFIG_TEST_REFS_PLAIN}")
+	_, _ = strict.expand("logs.mode", "${CONFIG_TEST_REFS_DEFAULT:-development}")
+	require.EqualError(t, strict.err(), `undefined environment variables:
+	CONFIG_TEST_REFS_OTHER, referenced by: rpc.listen
+	CONFIG_TEST_REFS_PLAIN, referenced by: logs.level, rpc.listen`)
+
+	assert.NoError(t, (&envRefs{strict: true}).err())
 }
 
 func TestGetShellName(t *testing.T) {
@@ -100,8 +192,13 @@ func TestExpandEnvViperTypes(t *testing.T) {
 	v.Set("flag", true)
 	v.Set("nested", map[string]any{"host": "${CONFIG_EXPAND_HOST}"})
 
-	expandEnvViper(v)
+	refs := expandEnvViper(v, &envRefs{})
 
+	assert.Equal(t, map[string][]string{
+		"str":         {"CONFIG_EXPAND_HOST"},
+		"strs":        {"CONFIG_EXPAND_HOST"},
+		"nested.host": {"CONFIG_EXPAND_HOST"},
+	}, refs)
 	assert.Equal(t, "no references here", v.Get("plain"))
 	assert.Equal(t, "example.org", v.Get("str"))
 	assert.Equal(t, []string{"example.org", "second"}, v.Get("strs"))
@@ -122,7 +219,7 @@ func TestExpandEnvViperMixedSlice(t *testing.T) {
 	v := viper.New()
 	v.Set("mixed", []any{"${CONFIG_EXPAND_MIXED}", 7})
 
-	expandEnvViper(v)
+	expandEnvViper(v, &envRefs{})
 
 	require.Equal(t, []string{"expanded"}, v.Get("mixed"))
 }
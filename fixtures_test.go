@@ -18,6 +18,21 @@ func writeFile(t *testing.T, dir, name, body string) string {
 	return path
 }
 
+// restoreEnv makes the testing package restore the variables once the test ends, as
+// they are before it: an envfile sets its variables with os.Setenv, which the testing
+// package doesn't track.
+func restoreEnv(t *testing.T, names ...string) {
+	t.Helper()
+
+	for _, name := range names {
+		prev, ok := os.LookupEnv(name)
+		t.Setenv(name, prev)
+		if !ok {
+			require.NoError(t, os.Unsetenv(name))
+		}
+	}
+}
+
 // writeYAML writes body as a config file in a fresh temp directory and returns
 // its path. Paths are absolute, so include lists composed from them resolve the
 // same way regardless of the working directory.
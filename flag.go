@@ -0,0 +1,311 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/roadrunner-server/errors"
+	"github.com/spf13/viper"
+	"go.yaml.in/yaml/v3"
+)
+
+// flagOp is what a flag does to its key.
+type flagOp int
+
+const (
+	// flagSet sets the key: key=value.
+	flagSet flagOp = iota
+	// flagAppend appends to the list under the key: key+=value.
+	flagAppend
+	// flagDelete removes the key: key!
+	flagDelete
+)
+
+// override is a parsed -o flag.
+type override struct {
+	key   string
+	value string
+	op    flagOp
+	// quoted values are strings, the other ones are read as YAML
+	quoted bool
+}
+
+// parseOverride parses a flag in one of the forms:
+//
+//	http.pool.num_workers=4
+//	http.middleware=[gzip, headers]
+//	http.middleware+=headers
+//	http.pool.debug!
+//	server.user="1000"
+//
+// The value is read as YAML: 4 is an integer, [gzip, headers] a list and {a: 1} a
+// section. A quoted value is taken as a string, and so are the values of the env
+// variables it references.
+func parseOverride(flag string) (override, error) {
+	trimmed := strings.TrimSpace(flag)
+	if key, ok := strings.CutSuffix(trimmed, "!"); ok && !strings.Contains(trimmed, "=") {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			return override{}, errors.Str("key should not be empty")
+		}
+
+		return override{key: key, op: flagDelete}, nil
+	}
+
+	key, val, err := parseFlag(flag)
+	if err != nil {
+		return override{}, err
+	}
+
+	o := override{key: key, value: val, op: flagSet}
+	if k, ok := strings.CutSuffix(key, "+"); ok {
+		o.key, o.op = strings.TrimSpace(k), flagAppend
+		if o.key == "" {
+			return override{}, errors.Str("key should not be empty")
+		}
+	}
+
+	_, raw, _ := strings.Cut(flag, "=")
+	raw = strings.TrimSpace(raw)
+	o.quoted = raw != "" && strings.ContainsRune("\"'`", rune(raw[0]))
+
+	return o, nil
+}
+
+// refToken stands for an env reference of a flag value while the value is read as YAML.
+const refToken string = "__rr_env_ref_%d__"
+
+// typed reads the value of the flag and expands its env references. The literal text is
+// read as YAML, each reference standing in as a string, then the references are expanded
+// in the strings it holds: the value of a variable is never read as YAML. The version is
+// a string whatever it reads as, and so is a value that isn't valid YAML or that YAML
+// would alter: one holding a comment or an anchor, or reading as null, such as #s3cr3t.
+// A number or a timestamp YAML would read as another text, such as 0123, 1.10 or
+// 2006-01-02, stays a string as well, in a list or a section too.
+func (o override) typed(env *envRefs) (any, []string) {
+	if o.quoted || strings.EqualFold(o.key, versionKey) {
+		return env.expand(o.key, o.value)
+	}
+
+	refs := make(map[string]string)
+	var sb strings.Builder
+	last := 0
+	for i, span := range references(o.value) {
+		token := fmt.Sprintf(refToken, i)
+		refs[token] = o.value[span[0]:span[1]]
+		sb.WriteString(o.value[last:span[0]])
+		sb.WriteString(token)
+		last = span[1]
+	}
+	sb.WriteString(o.value[last:])
+
+	var node yaml.Node
+	var out any
+	if yaml.Unmarshal([]byte(sb.String()), &node) != nil || altersText(&node) {
+		return env.expand(o.key, o.value)
+	}
+
+	keepLiterals(&node)
+	if node.Decode(&out) != nil || out == nil {
+		return env.expand(o.key, o.value)
+	}
+
+	var names []string
+	out = mapStrings(out, func(str string) string {
+		for token, ref := range refs {
+			str = strings.ReplaceAll(str, token, ref)
+		}
+
+		expanded, n := env.expand(o.key, str)
+		names = append(names, n...)
+		return expanded
+	})
+
+	return out, names
+}
+
+// altersText reports whether the YAML document holds something that isn't carried by
+// the value it decodes to: a comment, an anchor or an alias.
+func altersText(node *yaml.Node) bool {
+	if node.HeadComment != "" || node.LineComment != "" || node.FootComment != "" || node.Anchor != "" || node.Kind == yaml.AliasNode {
+		return true
+	}
+
+	return slices.ContainsFunc(node.Content, altersText)
+}
+
+// keepLiterals makes strings of the plain scalars whose value isn't the text written: an
+// integer with a leading zero, which YAML reads as octal, a number that renders back as
+// another text, such as 1.10, and a timestamp, which no string field decodes.
+func keepLiterals(node *yaml.Node) {
+	if node.Kind == yaml.ScalarNode && node.Style == 0 && changesText(node) {
+		node.Tag = "!!str"
+	}
+
+	for _, child := range node.Content {
+		keepLiterals(child)
+	}
+}
+
+// changesText reports whether the scalar decodes to a value that doesn't render back as
+// its text.
+func changesText(node *yaml.Node) bool {
+	switch node.ShortTag() {
+	case "!!timestamp":
+		return true
+	case "!!int", "!!float":
+		var val any
+		if node.Decode(&val) != nil {
+			return true
+		}
+
+		out, err := yaml.Marshal(val)
+		return err != nil || strings.TrimSpace(string(out)) != node.Value
+	default:
+		return false
+	}
+}
+
+// mapStrings returns val with fn applied to every string it holds, the keys of its
+// sections included.
+func mapStrings(val any, fn func(string) string) any {
+	switch t := val.(type) {
+	case string:
+		return fn(t)
+	case []any:
+		for i := range t {
+			t[i] = mapStrings(t[i], fn)
+		}
+		return t
+	case map[string]any:
+		out := make(map[string]any, len(t))
+		for k, v := range t {
+			out[fn(k)] = mapStrings(v, fn)
+		}
+		return out
+	default:
+		return val
+	}
+}
+
+// applyOverride applies the flag to v and returns the resulting configuration, which
+// is a fresh one when a key was deleted.
+func applyOverride(v *viper.Viper, o override, val any) (*viper.Viper, error) {
+	switch o.op {
+	case flagDelete:
+		return unset(v, o.key)
+	case flagAppend:
+		current := v.Get(o.key)
+		list, ok := asSlice(current)
+		if current != nil && !ok {
+			return nil, errors.Errorf("can't append to `%s`, it holds a %T rather than a list", o.key, current)
+		}
+
+		if items, ok := asSlice(val); ok {
+			list = append(list, items...)
+		} else {
+			list = append(list, val)
+		}
+
+		v.Set(o.key, list)
+	default:
+		v.Set(o.key, val)
+	}
+
+	return v, nil
+}
+
+// unset returns a copy of v without the key. Viper has no way to remove a key, a value
+// set over it would only hide it, so the configuration is rebuilt without it.
+func unset(v *viper.Viper, key string) (*viper.Viper, error) {
+	settings := v.AllSettings()
+
+	parts := strings.Split(strings.ToLower(key), ".")
+	section := settings
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := section[part].(map[string]any)
+		if !ok {
+			return v, nil
+		}
+
+		// the sections are copied on the way down, AllSettings may share them with v
+		next = maps.Clone(next)
+		section[part] = next
+		section = next
+	}
+
+	delete(section, parts[len(parts)-1])
+
+	return rebuild(v, settings)
+}
+
+// rebuild returns a fresh configuration holding the settings, in place of v.
+func rebuild(v *viper.Viper, settings map[string]any) (*viper.Viper, error) {
+	out := viper.New()
+	out.SetConfigFile(v.ConfigFileUsed())
+	err := out.MergeConfigMap(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// isLoaderKey reports whether the key is consumed by the loader rather than read by the
+// plugins: the include list and the version.
+func isLoaderKey(key string) bool {
+	return strings.EqualFold(key, includeKey) || strings.EqualFold(key, versionKey)
+}
+
+// applyFlags applies the Flags whose key the filter accepts, in order. A flag setting the
+// include list replaces the entries of the first of the lists.
+func (p *Plugin) applyFlags(snap *snapshot, env *envRefs, lists []includeList, filter func(key string) bool) error {
+	for _, f := range p.Flags {
+		o, err := parseOverride(f)
+		if err != nil {
+			return err
+		}
+
+		if !filter(o.key) {
+			continue
+		}
+
+		var val any
+		var names []string
+		if o.op != flagDelete {
+			val, names = o.typed(env)
+		}
+
+		if o.op == flagDelete && !snap.viper.IsSet(o.key) {
+			snap.warnings = append(snap.warnings, Warning{
+				Kind:    WarningIgnoredFlag,
+				Message: "the flag removes a key the configuration doesn't have, it's ignored",
+				Key:     o.key,
+				Fields:  map[string]string{"flag": f},
+			})
+			continue
+		}
+
+		snap.viper, err = applyOverride(snap.viper, o, val)
+		if err != nil {
+			return err
+		}
+
+		if o.op == flagDelete {
+			snap.origins.drop(o.key)
+		} else {
+			snap.origins.set(o.key, Origin{Layer: LayerFlag, Flag: f, Env: names})
+		}
+
+		if strings.EqualFold(o.key, includeKey) && len(lists) > 0 {
+			lists[0].entries, err = parseIncludes(snap.viper.Get(includeKey), &envRefs{})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
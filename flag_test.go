@@ -0,0 +1,175 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const flagsConfig = `version: "3"
+http:
+  address: 127.0.0.1:8080
+  middleware: [gzip]
+  pool:
+    num_workers: 2
+    debug: true
+`
+
+func TestTypedFlags(t *testing.T) {
+	t.Setenv("CONFIG_TEST_FLAG_WORKERS", "8")
+	t.Setenv("CONFIG_TEST_FLAG_PASS", "a: b")
+	t.Setenv("CONFIG_TEST_FLAG_ITEM", "x, y")
+
+	tests := []struct {
+		name string
+		flag string
+		key  string
+		want any
+	}{
+		{name: "integer", flag: "http.pool.num_workers=4", key: "http.pool.num_workers", want: 4},
+		{name: "boolean", flag: "http.pool.debug=false", key: "http.pool.debug", want: false},
+		{name: "float", flag: "http.ratio=0.5", key: "http.ratio", want: 0.5},
+		{name: "duration stays a string", flag: "http.pool.destroy_timeout=30s", key: "http.pool.destroy_timeout", want: "30s"},
+		{name: "flow list", flag: "http.middleware=[gzip, headers]", key: "http.middleware", want: []any{"gzip", "headers"}},
+		{name: "flow map", flag: "http.pool={num_workers: 1}", key: "http.pool", want: map[string]any{"num_workers": 1}},
+		{name: "quoted value is a string", flag: `http.pool.num_workers="4"`, key: "http.pool.num_workers", want: "4"},
+		{name: "single quotes too", flag: "http.pool.debug='true'", key: "http.pool.debug", want: "true"},
+		{name: "env value is a string", flag: "http.pool.num_workers=${CONFIG_TEST_FLAG_WORKERS}", key: "http.pool.num_workers", want: "8"},
+		{name: "env value isn't read as YAML", flag: "kv.redis.password=${CONFIG_TEST_FLAG_PASS}", key: "kv.redis.password", want: "a: b"},
+		{name: "env values in a flow list", flag: "http.middleware=[gzip, ${CONFIG_TEST_FLAG_ITEM}, h-$CONFIG_TEST_FLAG_WORKERS]", key: "http.middleware", want: []any{"gzip", "x, y", "h-8"}},
+		{name: "env default in a flow map", flag: "http.pool={num_workers: 1, user: '${CONFIG_TEST_FLAG_USER:-rr}'}", key: "http.pool", want: map[string]any{"num_workers": 1, "user": "rr"}},
+		{name: "invalid YAML stays a string", flag: "http.address=[0.0.0.0:80", key: "http.address", want: "[0.0.0.0:80"},
+		{name: "comment stays a string", flag: "kv.redis.password=#s3cr3t", key: "kv.redis.password", want: "#s3cr3t"},
+		{name: "trailing comment stays a string", flag: "kv.redis.user=abc #1", key: "kv.redis.user", want: "abc #1"},
+		{name: "anchor stays a string", flag: "kv.redis.password=&x", key: "kv.redis.password", want: "&x"},
+		{name: "anchored value stays a string", flag: "kv.redis.password=&x pass", key: "kv.redis.password", want: "&x pass"},
+		{name: "alias stays a string", flag: "kv.redis.password=*x", key: "kv.redis.password", want: "*x"},
+		{name: "null stays a string", flag: "kv.redis.password=~", key: "kv.redis.password", want: "~"},
+		{name: "escaped dollar", flag: "kv.redis.password=p$$ss", key: "kv.redis.password", want: "p$ss"},
+		{name: "version is a string", flag: "version=3", key: "version", want: "3"},
+		{name: "leading zero stays a string", flag: "kv.redis.password=0123", key: "kv.redis.password", want: "0123"},
+		{name: "trailing zero stays a string", flag: "app.version=1.10", key: "app.version", want: "1.10"},
+		{name: "date stays a string", flag: "app.layout=2006-01-02", key: "app.layout", want: "2006-01-02"},
+		{name: "timestamp stays a string", flag: "app.since=2026-10-17T10:00:00Z", key: "app.since", want: "2026-10-17T10:00:00Z"},
+		{name: "hex stays a string", flag: "app.mask=0x1F", key: "app.mask", want: "0x1F"},
+		{name: "literals in a flow list", flag: "app.codes=[0123, 1.10, 7, 2006-01-02]", key: "app.codes", want: []any{"0123", "1.10", 7, "2006-01-02"}},
+		{name: "negative integer", flag: "app.offset=-5", key: "app.offset", want: -5},
+		{name: "zero", flag: "app.offset=0", key: "app.offset", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Plugin{Path: writeYAML(t, flagsConfig), Flags: []string{tt.flag}}
+			require.NoError(t, p.Init())
+
+			assert.Equal(t, tt.want, p.Get(tt.key))
+		})
+	}
+
+	// a string holding a number still decodes into a number
+	p := &Plugin{Path: writeYAML(t, flagsConfig), Flags: []string{"http.pool.num_workers=${CONFIG_TEST_FLAG_WORKERS}"}}
+	require.NoError(t, p.Init())
+
+	var pool struct {
+		NumWorkers int `mapstructure:"num_workers"`
+	}
+	require.NoError(t, p.UnmarshalKey("http.pool", &pool))
+	assert.Equal(t, 8, pool.NumWorkers)
+
+	// and a literal kept as a string decodes into a string field
+	p = &Plugin{Path: writeYAML(t, flagsConfig), Flags: []string{"app.layout=2006-01-02", "app.mode=0640"}}
+	require.NoError(t, p.Init())
+
+	var app struct {
+		Layout string `mapstructure:"layout"`
+		Mode   string `mapstructure:"mode"`
+	}
+	require.NoError(t, p.UnmarshalKey("app", &app))
+	assert.Equal(t, "2006-01-02", app.Layout)
+	assert.Equal(t, "0640", app.Mode)
+}
+
+func TestFlagAppend(t *testing.T) {
+	p := &Plugin{
+		Path: writeYAML(t, flagsConfig),
+		Flags: []string{
+			"http.middleware+=headers",
+			"http.middleware += [static, sendfile]",
+			"http.uploads.forbid+=.php",
+		},
+	}
+	require.NoError(t, p.Init())
+
+	assert.Equal(t, []any{"gzip", "headers", "static", "sendfile"}, p.Get("http.middleware"))
+	assert.Equal(t, []any{".php"}, p.Get("http.uploads.forbid"))
+
+	p = &Plugin{Path: writeYAML(t, flagsConfig), Flags: []string{"http.address+=x"}}
+	require.ErrorContains(t, p.Init(), "can't append to `http.address`, it holds a string rather than a list")
+}
+
+func TestFlagDelete(t *testing.T) {
+	p := &Plugin{
+		Path:  writeYAML(t, flagsConfig),
+		Flags: []string{"http.pool.debug!", "http.middleware !", "http.missing.key!"},
+	}
+	require.NoError(t, p.Init())
+
+	assert.False(t, p.Has("http.pool.debug"))
+	assert.False(t, p.Has("http.middleware"))
+	assert.Equal(t, 2, p.Get("http.pool.num_workers"))
+	assert.Equal(t, map[string]any{"num_workers": 2}, p.Get("http.pool"))
+
+	_, ok := p.Origin("http.pool.debug")
+	assert.False(t, ok)
+
+	// a whole section, and a key set back after its removal
+	p = &Plugin{Path: writeYAML(t, flagsConfig), Flags: []string{"http!", "http.address=0.0.0.0:80"}}
+	require.NoError(t, p.Init())
+
+	assert.Equal(t, map[string]any{"address": "0.0.0.0:80"}, p.Get("http"))
+}
+
+// TestFlagsOverrideIncludes covers the Flags as the top layer: they set and remove the
+// keys an included file brought in.
+func TestFlagsOverrideIncludes(t *testing.T) {
+	dir := t.TempDir()
+	sub := writeFile(t, dir, "http.yaml", "version: \"3\"\nhttp:\n  address: 127.0.0.1:8080\n  pool:\n    num_workers: 2\n    debug: true\n")
+
+	p := &Plugin{
+		Path:  rootWithIncludes(t, dir, rpcConfigBody, sub),
+		Flags: []string{"http.pool.num_workers=8", "http.pool.debug!"},
+	}
+	require.NoError(t, p.Init())
+
+	assert.Equal(t, 8, p.Get("http.pool.num_workers"))
+	assert.False(t, p.Has("http.pool.debug"))
+	assert.Equal(t, "127.0.0.1:8080", p.Get("http.address"))
+}
+
+func TestParseOverride(t *testing.T) {
+	tests := []struct {
+		flag string
+		want override
+	}{
+		{flag: "a.b=1", want: override{key: "a.b", value: "1"}},
+		{flag: "a.b+=1", want: override{key: "a.b", value: "1", op: flagAppend}},
+		{flag: "a.b += 1", want: override{key: "a.b", value: "1", op: flagAppend}},
+		{flag: "a.b!", want: override{key: "a.b", op: flagDelete}},
+		{flag: `a.b="1"`, want: override{key: "a.b", value: "1", quoted: true}},
+		{flag: "a.b=c!", want: override{key: "a.b", value: "c!"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.flag, func(t *testing.T) {
+			o, err := parseOverride(tt.flag)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, o)
+		})
+	}
+
+	_, err := parseOverride("!")
+	require.ErrorContains(t, err, "key should not be empty")
+	_, err = parseOverride("+=1")
+	require.ErrorContains(t, err, "key should not be empty")
+}
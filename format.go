@@ -0,0 +1,163 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/hcl"
+	"github.com/pelletier/go-toml/v2"
+	"github.com/roadrunner-server/errors"
+	"github.com/spf13/viper"
+	"go.yaml.in/yaml/v3"
+)
+
+// The configuration formats, as accepted by Type.
+const (
+	formatYAML string = "yaml"
+	formatJSON string = "json"
+	formatTOML string = "toml"
+	formatHCL  string = "hcl"
+)
+
+// detectOrder is the order the formats are tried in when neither Type nor the extension
+// tell the format: JSON first, as it's valid YAML as well, then YAML, whose documents
+// are rarely valid TOML or HCL.
+var detectOrder = []string{formatJSON, formatYAML, formatTOML, formatHCL}
+
+// readFile reads the configuration file at path, in the format typ when set, else in
+// the one its extension tells, else in the one its content reads as.
+func readFile(path, typ string) (*viper.Viper, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if typ == "" {
+		typ = formatOf(path)
+	}
+
+	v, err := readConfig(data, typ)
+	if err != nil {
+		return nil, errors.Errorf("%s: %v", path, err)
+	}
+
+	v.SetConfigFile(path)
+
+	return v, nil
+}
+
+// readConfig reads the configuration in the format typ, detected from the content when
+// empty.
+func readConfig(data []byte, typ string) (*viper.Viper, error) {
+	var settings map[string]any
+	var err error
+
+	if typ == "" {
+		settings, err = detect(data)
+	} else {
+		settings, err = decode(data, typ)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	v := viper.New()
+	err = v.MergeConfigMap(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// formatOf returns the format the extension of the path tells, empty when it tells none.
+func formatOf(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return formatYAML
+	case ".json":
+		return formatJSON
+	case ".toml":
+		return formatTOML
+	case ".hcl", ".tf":
+		return formatHCL
+	default:
+		return ""
+	}
+}
+
+// detect decodes the content in the first format it's valid in.
+func detect(data []byte) (map[string]any, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return map[string]any{}, nil
+	}
+
+	for _, typ := range detectOrder {
+		settings, err := decode(data, typ)
+		if err == nil {
+			return settings, nil
+		}
+	}
+
+	return nil, errors.Str("unable to detect the configuration format, expected YAML, JSON, TOML or HCL")
+}
+
+// decode decodes the content in the format typ, which has to hold a section at its top.
+func decode(data []byte, typ string) (map[string]any, error) {
+	settings := make(map[string]any)
+
+	var err error
+	switch strings.ToLower(typ) {
+	case formatYAML, "yml":
+		err = yaml.Unmarshal(data, &settings)
+	case formatJSON:
+		err = json.Unmarshal(data, &settings)
+	case formatTOML:
+		err = toml.Unmarshal(data, &settings)
+	case formatHCL:
+		err = hcl.Unmarshal(data, &settings)
+		settings = flattenHCL(settings).(map[string]any)
+	default:
+		return nil, errors.Errorf("unsupported configuration format `%s`, supported formats are: yaml, json, toml, hcl", typ)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return settings, nil
+}
+
+// flattenHCL turns the blocks of an HCL document, which decode as lists of sections, into
+// the sections they stand for: http { pool { num_workers = 4 } } is http.pool.num_workers.
+// A block repeated under the same name stays a list.
+func flattenHCL(val any) any {
+	switch t := val.(type) {
+	case map[string]any:
+		for k, v := range t {
+			t[k] = flattenHCL(v)
+		}
+		return t
+	case []map[string]any:
+		if len(t) == 1 {
+			return flattenHCL(t[0])
+		}
+
+		out := make([]any, 0, len(t))
+		for _, item := range t {
+			out = append(out, flattenHCL(item))
+		}
+		return out
+	case []any:
+		for i := range t {
+			t[i] = flattenHCL(t[i])
+		}
+		return t
+	default:
+		return val
+	}
+}
@@ -0,0 +1,180 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRootFileFormats(t *testing.T) {
+	t.Setenv("RR_TEST_FORMAT_LISTEN", "tcp://127.0.0.1:6001")
+
+	tests := []struct {
+		name string
+		file string
+		body string
+	}{
+		{
+			name: "json",
+			file: ".rr.json",
+			body: `{
+  "version": "3",
+  "rpc": {"listen": "${RR_TEST_FORMAT_LISTEN}"},
+  "http": {"pool": {"num_workers": 4, "debug": true}, "middleware": ["gzip", "headers"]}
+}`,
+		},
+		{
+			name: "toml",
+			file: ".rr.toml",
+			body: `version = "3"
+
+[rpc]
+listen = "${RR_TEST_FORMAT_LISTEN}"
+
+[http]
+middleware = ["gzip", "headers"]
+
+[http.pool]
+num_workers = 4
+debug = true
+`,
+		},
+		{
+			name: "hcl",
+			file: ".rr.hcl",
+			body: `version = "3"
+
+rpc {
+  listen = "${RR_TEST_FORMAT_LISTEN}"
+}
+
+http {
+  middleware = ["gzip", "headers"]
+
+  pool {
+    num_workers = 4
+    debug = true
+  }
+}
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Plugin{Path: writeFile(t, t.TempDir(), tt.file, tt.body)}
+			require.NoError(t, p.Init())
+
+			assert.Equal(t, "tcp://127.0.0.1:6001", p.Get("rpc.listen"))
+			assert.Equal(t, 4, p.viper.GetInt("http.pool.num_workers"))
+			assert.True(t, p.viper.GetBool("http.pool.debug"))
+			assert.Equal(t, []string{"gzip", "headers"}, p.viper.GetStringSlice("http.middleware"))
+
+			var pool struct {
+				NumWorkers int  `mapstructure:"num_workers"`
+				Debug      bool `mapstructure:"debug"`
+			}
+			require.NoError(t, p.UnmarshalKey("http.pool", &pool))
+			assert.Equal(t, 4, pool.NumWorkers)
+			assert.True(t, pool.Debug)
+		})
+	}
+}
+
+func TestRootFileVersionChecksAcrossFormats(t *testing.T) {
+	tests := []struct {
+		file string
+		body string
+		err  string
+	}{
+		{file: ".rr.json", body: `{"rpc": {"listen": "tcp://127.0.0.1:6001"}}`, err: "version"},
+		{file: ".rr.toml", body: "version = 3\n", err: "version"},
+		{file: ".rr.hcl", body: "rpc {\n  listen = \"tcp://127.0.0.1:6001\"\n}\n", err: "version"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			p := &Plugin{Path: writeFile(t, t.TempDir(), tt.file, tt.body)}
+			assert.ErrorContains(t, p.Init(), tt.err)
+		})
+	}
+}
+
+func TestIncludeAcrossFormats(t *testing.T) {
+	dir := t.TempDir()
+	jsonSub := writeFile(t, dir, "http.json", `{"version": "3", "http": {"address": "127.0.0.1:8080"}}`)
+	tomlSub := writeFile(t, dir, "kv.toml", "version = \"3\"\n\n[kv.local]\ndriver = \"memory\"\n")
+	hclSub := writeFile(t, dir, "x.hcl", "version = \"3\"\n\nx {\n  y = \"hcl\"\n}\n")
+	root := writeFile(t, dir, ".rr.toml", `version = "3"
+include = ["`+jsonSub+`", "`+tomlSub+`", "`+hclSub+`"]
+
+[rpc]
+listen = "tcp://127.0.0.1:6001"
+`)
+
+	p := &Plugin{Path: root}
+	require.NoError(t, p.Init())
+
+	assert.Equal(t, "tcp://127.0.0.1:6001", p.Get("rpc.listen"))
+	assert.Equal(t, "127.0.0.1:8080", p.Get("http.address"))
+	assert.Equal(t, "memory", p.Get("kv.local.driver"))
+	assert.Equal(t, "hcl", p.Get("x.y"))
+}
+
+func TestIncludedFileVersionMustMatchAcrossFormats(t *testing.T) {
+	dir := t.TempDir()
+	sub := writeFile(t, dir, "sub.json", `{"version": "2.7", "http": {"address": "127.0.0.1:8080"}}`)
+
+	p := &Plugin{Path: rootWithIncludes(t, dir, rpcConfigBody, sub)}
+	assert.ErrorContains(t, p.Init(), "version")
+}
+
+func TestFormatDetectedWithoutExtension(t *testing.T) {
+	tests := map[string]string{
+		"yaml": rpcConfig,
+		"json": `{"version": "3", "rpc": {"listen": "tcp://127.0.0.1:6391"}}`,
+		"toml": "version = \"3\"\n\n[rpc]\nlisten = \"tcp://127.0.0.1:6391\"\n",
+	}
+
+	for name, body := range tests {
+		t.Run(name, func(t *testing.T) {
+			p := &Plugin{Path: writeFile(t, t.TempDir(), "rr", body)}
+			require.NoError(t, p.Init())
+			assert.Equal(t, "tcp://127.0.0.1:6391", p.Get("rpc.listen"))
+		})
+	}
+}
+
+func TestFormatUndetectable(t *testing.T) {
+	p := &Plugin{Path: writeFile(t, t.TempDir(), "rr", "version: \"3\"\n  rpc: [broken\n")}
+	assert.ErrorContains(t, p.Init(), "unable to detect the configuration format")
+}
+
+func TestTypeOverridesExtension(t *testing.T) {
+	body := "version = \"3\"\n\n[rpc]\nlisten = \"tcp://127.0.0.1:6391\"\n"
+	p := &Plugin{Path: writeFile(t, t.TempDir(), "rr.conf", body), Type: "toml"}
+	require.NoError(t, p.Init())
+	assert.Equal(t, "tcp://127.0.0.1:6391", p.Get("rpc.listen"))
+}
+
+func TestInlineConfigHonorsType(t *testing.T) {
+	tests := map[string]string{
+		"json": `{"version": "3", "rpc": {"listen": "tcp://127.0.0.1:6391"}}`,
+		"toml": "version = \"3\"\n\n[rpc]\nlisten = \"tcp://127.0.0.1:6391\"\n",
+		"hcl":  "version = \"3\"\n\nrpc {\n  listen = \"tcp://127.0.0.1:6391\"\n}\n",
+	}
+
+	for typ, body := range tests {
+		t.Run(typ, func(t *testing.T) {
+			p := &Plugin{Type: typ, ReadInCfg: []byte(body)}
+			require.NoError(t, p.Init())
+			assert.Equal(t, "tcp://127.0.0.1:6391", p.Get("rpc.listen"))
+		})
+	}
+}
+
+func TestUnsupportedType(t *testing.T) {
+	p := &Plugin{Type: "ini", ReadInCfg: []byte("[rpc]\nlisten = tcp://127.0.0.1:6391\n")}
+	assert.ErrorContains(t, p.Init(), "unsupported configuration format `ini`")
+}
@@ -1,68 +1,290 @@
 package config
 
 import (
+	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 
 	"github.com/joho/godotenv"
 	"github.com/roadrunner-server/errors"
 	"github.com/spf13/viper"
 )
 
-func getConfiguration(path string) (map[string]any, string, error) {
-	v := viper.New()
-	v.SetConfigFile(path)
-	err := v.ReadInConfig()
+// maxIncludeDepth limits how deep the included files may include other files.
+const maxIncludeDepth = 10
+
+// fileConfig is an included configuration file, read and expanded.
+type fileConfig struct {
+	settings map[string]any
+	version  string
+	keys     []string
+	// includes are the entries of the file's own include key, unresolved
+	includes []includeEntry
+	// env maps the keys to the env variables their values referenced
+	env map[string][]string
+}
+
+// includeEntry is an item of an include list. It's either a path, or a section with a
+// path and the optional flag:
+//
+//	include:
+//	  - base.yaml
+//	  - conf.d/*.yaml
+//	  - ?local.yaml
+//	  - path: local.yaml
+//	    optional: true
+//
+// The path may be a glob pattern, expanded in lexical order. A leading ? marks the
+// entry as optional: a missing file, or a pattern matching nothing, is skipped. A glob
+// pattern starting with ? has to use the section form.
+type includeEntry struct {
+	path     string
+	optional bool
+}
+
+// includeList is the include entries of a file, which are resolved against it.
+type includeList struct {
+	parent  string
+	entries []includeEntry
+}
+
+// parseIncludes reads the entries of an include list as found in a file, before the env
+// expansion, which is applied to the paths here.
+func parseIncludes(raw any, env *envRefs) ([]includeEntry, error) {
+	if raw == nil {
+		return nil, nil
+	}
+
+	// a flag passes the list as a single string
+	if str, ok := raw.(string); ok {
+		raw = strings.Fields(str)
+	}
+
+	items, ok := asSlice(raw)
+	if !ok {
+		return nil, errors.Errorf("include should be a list, actual type is: %T", raw)
+	}
+
+	entries := make([]includeEntry, 0, len(items))
+	for _, item := range items {
+		var entry includeEntry
+		switch t := item.(type) {
+		case string:
+			entry.path = t
+			if strings.HasPrefix(t, "?") {
+				entry.path, entry.optional = t[1:], true
+			}
+		case map[string]any:
+			path, ok := t["path"].(string)
+			if !ok {
+				return nil, errors.Errorf("include entry should have a path: %v", t)
+			}
+
+			optional, ok := t["optional"].(bool)
+			if _, set := t["optional"]; set && !ok {
+				return nil, errors.Errorf("optional should be a boolean in the include entry: %v", t)
+			}
+
+			entry = includeEntry{path: path, optional: optional}
+		default:
+			return nil, errors.Errorf("include entries should be paths or sections with a path, actual type is: %T", item)
+		}
+
+		entry.path, _ = env.expand(includeKey, entry.path)
+		if entry.path == "" {
+			return nil, errors.Str("include entry should not be empty")
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+func getConfiguration(path string, env *envRefs) (*fileConfig, error) {
+	v, err := readFile(path, "")
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
 
 	// get configuration version
 	ver := v.Get(versionKey)
 	if ver == nil {
-		return nil, "", errors.Str("rr configuration file should contain a version e.g: version: 2.7")
+		return nil, errors.Str("rr configuration file should contain a version e.g: version: 2.7")
 	}
 
 	if _, ok := ver.(string); !ok {
-		return nil, "", errors.Errorf("type of version should be string, actual: %T", ver)
+		return nil, errors.Errorf("type of version should be string, actual: %T", ver)
+	}
+
+	includes, err := parseIncludes(v.Get(includeKey), env)
+	if err != nil {
+		return nil, err
 	}
 
 	// automatically inject ENV variables using ${ENV} pattern
-	expandEnvViper(v)
+	refs := expandEnvViper(v, env)
+
+	// the include key is consumed by the loader, it doesn't override the root's one
+	settings := v.AllSettings()
+	delete(settings, includeKey)
+	keys := slices.DeleteFunc(v.AllKeys(), func(key string) bool { return key == includeKey })
 
-	return v.AllSettings(), ver.(string), nil
+	return &fileConfig{settings: settings, version: ver.(string), keys: keys, includes: includes, env: refs}, nil
 }
 
-func (p *Plugin) handleInclude(rootVersion string) error {
-	ifiles := p.viper.GetStringSlice(includeKey)
-	if ifiles == nil {
-		return nil
+// handleInclude applies the files listed under the include key of the root, each one
+// deep merged over the configuration built so far: an included file only overrides
+// the keys it sets, the lists being combined according to ListMerge. The files an
+// included file lists are applied right after it, in turn overriding it, before moving
+// on to the next entry: for a root including [a, b], where a includes [c], the order is
+// root, a, c, b. The files matched by a glob pattern are applied in lexical order. The
+// lists are applied in order.
+func (p *Plugin) handleInclude(snap *snapshot, lists []includeList, rootVersion string, env *envRefs) error {
+	m, err := p.merger()
+	if err != nil {
+		return err
 	}
 
-	for _, file := range ifiles {
-		config, version, err := getConfiguration(file)
+	for _, list := range lists {
+		err = p.includeEntries(snap, m, list.parent, list.entries, rootVersion, env, []string{absPath(list.parent)})
 		if err != nil {
 			return err
 		}
+	}
+
+	return nil
+}
 
-		if version != rootVersion {
-			return errors.Str("version in included file must be the same as in root")
+// includeEntries applies the entries listed by the file at parent.
+func (p *Plugin) includeEntries(snap *snapshot, m merger, parent string, entries []includeEntry, rootVersion string, env *envRefs, chain []string) error {
+	for _, entry := range entries {
+		files, err := p.resolveInclude(snap, parent, entry)
+		if err != nil {
+			return err
 		}
 
-		// overriding configuration
-		for key, val := range config {
-			p.viper.Set(key, val)
+		for _, file := range files {
+			err = p.includeFile(snap, m, file, rootVersion, env, chain)
+			if err != nil {
+				return err
+			}
 		}
 	}
 
 	return nil
 }
 
-func (p *Plugin) handleEnvFile() error {
-	envFile := p.viper.GetString(envFileKey)
-	if envFile != "" {
-		dir, _ := filepath.Split(p.Path)
-		return godotenv.Load(filepath.Join(dir, envFile))
+// resolveInclude returns the files an entry stands for. The patterns, and the optional
+// files found missing, are recorded in the snapshot: a file showing up there later is
+// a reason to reload.
+func (p *Plugin) resolveInclude(snap *snapshot, parent string, entry includeEntry) ([]string, error) {
+	path := p.includePath(parent, entry.path)
+
+	if !strings.ContainsAny(entry.path, "*?[") {
+		if entry.optional {
+			if _, err := os.Stat(path); os.IsNotExist(err) {
+				snap.patterns = append(snap.patterns, path)
+				return nil, nil
+			}
+		}
+
+		return []string{path}, nil
 	}
 
-	return nil
+	snap.patterns = append(snap.patterns, path)
+
+	files, err := filepath.Glob(path)
+	if err != nil {
+		return nil, errors.Errorf("invalid include pattern `%s`: %v", entry.path, err)
+	}
+
+	if len(files) == 0 && !entry.optional {
+		return nil, errors.Errorf("include pattern `%s` matches no files", entry.path)
+	}
+
+	return files, nil
+}
+
+// includeFile applies the file and, recursively, the files it includes. The chain holds
+// the files that led to this one, starting with the root.
+func (p *Plugin) includeFile(snap *snapshot, m merger, file, rootVersion string, env *envRefs, chain []string) error {
+	abs := absPath(file)
+	if slices.Contains(chain, abs) {
+		return errors.Errorf("include cycle: %s", strings.Join(append(chain, abs), " -> "))
+	}
+
+	if len(chain) > maxIncludeDepth {
+		return errors.Errorf("includes are nested deeper than %d levels: %s", maxIncludeDepth, strings.Join(append(chain, abs), " -> "))
+	}
+
+	config, err := getConfiguration(file, env)
+	if err != nil {
+		return err
+	}
+
+	if config.version != rootVersion {
+		return errors.Str("version in included file must be the same as in root")
+	}
+
+	// overriding configuration, the sections are merged rather than replaced
+	for key, val := range config.settings {
+		snap.viper.Set(key, m.merge(snap.viper.Get(key), val))
+	}
+
+	snap.origins.setFile(LayerInclude, file, config.keys, config.env)
+	snap.files = append(snap.files, file)
+
+	// a fresh slice per level, the siblings share the prefix
+	return p.includeEntries(snap, m, file, config.includes, rootVersion, env, append(chain[:len(chain):len(chain)], abs))
+}
+
+// includePath resolves an include entry of the file at parent. A relative entry is
+// joined to the directory of parent, the same way the envfile is, unless
+// IncludeRelativeToCwd asks for the working directory.
+func (p *Plugin) includePath(parent, entry string) string {
+	if filepath.IsAbs(entry) || p.IncludeRelativeToCwd {
+		return entry
+	}
+
+	return filepath.Join(filepath.Dir(parent), entry)
+}
+
+// handleEnvFile loads the .env file referenced by the 'envfile' key and returns its path.
+// Variables already present in the environment win over the file, except the ones an
+// earlier load took from the file: those follow the file, so a reload sees its edits.
+func (p *Plugin) handleEnvFile(v *viper.Viper) (string, error) {
+	envFile := v.GetString(envFileKey)
+	if envFile == "" {
+		return "", nil
+	}
+
+	path := filepath.Join(filepath.Dir(p.root()), envFile)
+
+	vars, err := godotenv.Read(path)
+	if err != nil {
+		return "", err
+	}
+
+	if p.envFileVars == nil {
+		p.envFileVars = make(map[string]struct{}, len(vars))
+	}
+
+	for key, val := range vars {
+		if _, set := os.LookupEnv(key); set {
+			if _, ours := p.envFileVars[key]; !ours {
+				continue
+			}
+		}
+
+		err = os.Setenv(key, val)
+		if err != nil {
+			return "", err
+		}
+
+		p.envFileVars[key] = struct{}{}
+	}
+
+	return path, nil
 }
@@ -5,14 +5,17 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
-// rootWithIncludes builds a root config in dir that pulls in the given files.
-// Include entries are resolved against the working directory, so the paths are
-// written out absolute.
+// rpcConfigBody is rpcConfig without its version, for the roots built by rootWithIncludes.
+const rpcConfigBody = "rpc:\n  listen: tcp://127.0.0.1:6391\n"
+
+// rootWithIncludes builds a root config in dir that pulls in the given files. The
+// entries are written out as given, a relative one is resolved against dir.
 func rootWithIncludes(t *testing.T, dir, body string, includes ...string) string {
 	t.Helper()
 
@@ -52,7 +55,7 @@ reload:
 
 	// Keys only the root defines survive the merge.
 	assert.Equal(t, "development", p.Get("logs.mode"))
-	assert.Equal(t, []any{".php"}, p.Get("reload.patterns"))
+	assert.Equal(t, []string{".php"}, p.Get("reload.patterns"))
 
 	// A section only the included file defines is reachable, down to a key
 	// nested three levels deep.
@@ -78,6 +81,241 @@ logs:
 	assert.Equal(t, "debug", p.Get("logs.level"))
 }
 
+func TestIncludeResolvedRelativeToConfigDir(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "conf"), 0o700))
+	writeFile(t, filepath.Join(dir, "conf"), "rpc.yaml", `version: "3"
+rpc:
+  listen: tcp://127.0.0.1:6392
+`)
+	root := rootWithIncludes(t, dir, rpcConfigBody, "conf/rpc.yaml")
+
+	// The working directory plays no part.
+	t.Chdir(t.TempDir())
+
+	p := &Plugin{Path: root}
+	require.NoError(t, p.Init())
+
+	assert.Equal(t, "tcp://127.0.0.1:6392", p.Get("rpc.listen"))
+}
+
+func TestIncludeRelativeToCwd(t *testing.T) {
+	cwd := t.TempDir()
+	writeFile(t, cwd, "rpc.yaml", `version: "3"
+rpc:
+  listen: tcp://127.0.0.1:6392
+`)
+	root := rootWithIncludes(t, t.TempDir(), rpcConfigBody, "rpc.yaml")
+
+	t.Chdir(cwd)
+
+	p := &Plugin{Path: root, IncludeRelativeToCwd: true}
+	require.NoError(t, p.Init())
+	assert.Equal(t, "tcp://127.0.0.1:6392", p.Get("rpc.listen"))
+
+	// Without the opt-out the entry is looked up next to the root file.
+	p = &Plugin{Path: root}
+	require.ErrorContains(t, p.Init(), "no such file")
+}
+
+// TestNestedIncludeOrder pins the documented merge order: an included file is
+// overridden by the files it includes, which are applied before the next entry of the
+// list that named it. For a root including [a, b], where a includes [c], that's root,
+// a, c, b.
+func TestNestedIncludeOrder(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "nested"), 0o700))
+	// c is listed by a relative to a's own directory.
+	writeFile(t, filepath.Join(dir, "nested"), "c.yaml", "version: \"3\"\nx: c\ny: c\n")
+	writeFile(t, dir, "a.yaml", "version: \"3\"\ninclude:\n  - nested/c.yaml\nx: a\ny: a\nz: a\n")
+	writeFile(t, dir, "b.yaml", "version: \"3\"\nx: b\n")
+	root := rootWithIncludes(t, dir, "x: root\ny: root\nz: root\nw: root\n", "a.yaml", "b.yaml")
+
+	p := &Plugin{Path: root}
+	require.NoError(t, p.Init())
+
+	assert.Equal(t, "b", p.Get("x"))
+	assert.Equal(t, "c", p.Get("y"))
+	assert.Equal(t, "a", p.Get("z"))
+	assert.Equal(t, "root", p.Get("w"))
+
+	// The include key of a nested file does not replace the root's one.
+	assert.Equal(t, []string{"a.yaml", "b.yaml"}, p.Get("include"))
+}
+
+func TestIncludeCycle(t *testing.T) {
+	dir := t.TempDir()
+	a := writeFile(t, dir, "a.yaml", "version: \"3\"\ninclude:\n  - b.yaml\n")
+	b := writeFile(t, dir, "b.yaml", "version: \"3\"\ninclude:\n  - a.yaml\n")
+	root := rootWithIncludes(t, dir, "", "a.yaml")
+
+	p := &Plugin{Path: root}
+
+	require.ErrorContains(t, p.Init(), fmt.Sprintf("include cycle: %s -> %s -> %s -> %s", root, a, b, a))
+}
+
+func TestIncludeOfTheRootIsACycle(t *testing.T) {
+	dir := t.TempDir()
+	a := writeFile(t, dir, "a.yaml", "version: \"3\"\ninclude:\n  - .rr.yaml\n")
+	root := rootWithIncludes(t, dir, "", "a.yaml")
+
+	p := &Plugin{Path: root}
+
+	require.ErrorContains(t, p.Init(), fmt.Sprintf("include cycle: %s -> %s -> %s", root, a, root))
+}
+
+// TestIncludeSameFileTwice checks that a file reached twice without a cycle, as the
+// shared base of two siblings, is not mistaken for one.
+func TestIncludeSameFileTwice(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "base.yaml", "version: \"3\"\napp:\n  level: base\n")
+	writeFile(t, dir, "a.yaml", "version: \"3\"\ninclude:\n  - base.yaml\n")
+	writeFile(t, dir, "b.yaml", "version: \"3\"\ninclude:\n  - base.yaml\n")
+	root := rootWithIncludes(t, dir, "", "a.yaml", "b.yaml")
+
+	p := &Plugin{Path: root}
+	require.NoError(t, p.Init())
+
+	assert.Equal(t, "base", p.Get("app.level"))
+}
+
+func TestIncludeDepthLimit(t *testing.T) {
+	dir := t.TempDir()
+	for i := range maxIncludeDepth + 1 {
+		writeFile(t, dir, fmt.Sprintf("%d.yaml", i), fmt.Sprintf("version: \"3\"\ninclude:\n  - %d.yaml\n", i+1))
+	}
+	writeFile(t, dir, fmt.Sprintf("%d.yaml", maxIncludeDepth+1), "version: \"3\"\n")
+
+	p := &Plugin{Path: rootWithIncludes(t, dir, "", "0.yaml")}
+
+	require.ErrorContains(t, p.Init(), fmt.Sprintf("includes are nested deeper than %d levels", maxIncludeDepth))
+
+	// One level less is fine.
+	writeFile(t, dir, fmt.Sprintf("%d.yaml", maxIncludeDepth-1), "version: \"3\"\n")
+	require.NoError(t, p.Init())
+}
+
+func TestIncludeGlobInLexicalOrder(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "conf.d"), 0o700))
+	confd := filepath.Join(dir, "conf.d")
+	writeFile(t, confd, "20-http.yaml", "version: \"3\"\nhttp:\n  address: 127.0.0.1:8080\nx: 20\n")
+	writeFile(t, confd, "10-rpc.yaml", "version: \"3\"\nrpc:\n  listen: tcp://127.0.0.1:6392\nx: 10\n")
+	writeFile(t, confd, "README.md", "not a config")
+
+	p := &Plugin{Path: rootWithIncludes(t, dir, "x: root\n", "conf.d/*.yaml")}
+	require.NoError(t, p.Init())
+
+	assert.Equal(t, "tcp://127.0.0.1:6392", p.Get("rpc.listen"))
+	assert.Equal(t, "127.0.0.1:8080", p.Get("http.address"))
+	// 20-http.yaml sorts after 10-rpc.yaml, so it wins.
+	assert.Equal(t, 20, p.Get("x"))
+}
+
+func TestIncludeGlobMatchingNothing(t *testing.T) {
+	dir := t.TempDir()
+
+	p := &Plugin{Path: rootWithIncludes(t, dir, "", "conf.d/*.yaml")}
+	require.ErrorContains(t, p.Init(), "include pattern `conf.d/*.yaml` matches no files")
+
+	p = &Plugin{Path: rootWithIncludes(t, dir, rpcConfigBody, "?conf.d/*.yaml")}
+	require.NoError(t, p.Init())
+	assert.Equal(t, "tcp://127.0.0.1:6391", p.Get("rpc.listen"))
+}
+
+func TestIncludeOptionalEntries(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "present.yaml", "version: \"3\"\nlogs:\n  level: debug\n")
+	root := writeFile(t, dir, ".rr.yaml", `version: "3"
+include:
+  - ?local.yaml
+  - path: also-missing.yaml
+    optional: true
+  - path: present.yaml
+    optional: true
+logs:
+  level: info
+`)
+
+	p := &Plugin{Path: root}
+	require.NoError(t, p.Init())
+
+	assert.Equal(t, "debug", p.Get("logs.level"))
+}
+
+// TestIncludeOptionalBrokenFile checks that optional only covers a missing file, a file
+// that is there but broken still fails Init.
+func TestIncludeOptionalBrokenFile(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "local.yaml", "logs:\n  level: debug\n")
+
+	p := &Plugin{Path: rootWithIncludes(t, dir, "", "?local.yaml")}
+
+	require.ErrorContains(t, p.Init(), "rr configuration file should contain a version")
+}
+
+func TestIncludeEntryErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		include string
+		want    string
+	}{
+		{name: "not a list", include: "include: 5\n", want: "include should be a list"},
+		{name: "section without a path", include: "include:\n  - optional: true\n", want: "include entry should have a path"},
+		{name: "optional is not a boolean", include: "include:\n  - path: a.yaml\n    optional: maybe\n", want: "optional should be a boolean"},
+		{name: "item of a wrong type", include: "include:\n  - 5\n", want: "include entries should be paths or sections with a path"},
+		{name: "empty entry", include: "include:\n  - ${CONFIG_TEST_INCLUDE_UNSET}\n", want: "include entry should not be empty"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Plugin{Path: writeYAML(t, "version: \"3\"\n"+tt.include)}
+
+			require.ErrorContains(t, p.Init(), tt.want)
+		})
+	}
+}
+
+func TestIncludeEntriesExpandEnv(t *testing.T) {
+	t.Setenv("CONFIG_TEST_INCLUDE_ENV", "prod")
+
+	dir := t.TempDir()
+	writeFile(t, dir, "prod.yaml", "version: \"3\"\nlogs:\n  level: error\n")
+	root := writeFile(t, dir, ".rr.yaml", `version: "3"
+include:
+  - ${CONFIG_TEST_INCLUDE_ENV}.yaml
+  - path: ${CONFIG_TEST_INCLUDE_ENV}-local.yaml
+    optional: true
+`)
+
+	p := &Plugin{Path: root}
+	require.NoError(t, p.Init())
+
+	assert.Equal(t, "error", p.Get("logs.level"))
+}
+
+// TestWatchPicksUpNewGlobMatch checks that a file showing up in a directory an include
+// pattern covers triggers a reload.
+func TestWatchPicksUpNewGlobMatch(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "conf.d"), 0o700))
+
+	p := &Plugin{Path: rootWithIncludes(t, dir, rpcConfigBody, "?conf.d/*.yaml"), Watch: true}
+	require.NoError(t, p.Init())
+
+	errCh := p.Serve()
+	t.Cleanup(func() {
+		require.NoError(t, p.Stop(t.Context()))
+		assert.Empty(t, errCh)
+	})
+
+	writeFile(t, filepath.Join(dir, "conf.d"), "rpc.yaml", "version: \"3\"\nrpc:\n  listen: tcp://127.0.0.1:6392\n")
+
+	require.Eventually(t, func() bool {
+		return p.Get("rpc.listen") == "tcp://127.0.0.1:6392"
+	}, time.Second*5, time.Millisecond*20)
+}
+
 func TestIncludeWorksWithoutExperimentalFeatures(t *testing.T) {
 	dir := t.TempDir()
 	sub := writeFile(t, dir, ".rr-sub.yaml", `version: "3"
@@ -178,8 +416,7 @@ logs:
 }
 
 // TestEnvFileResolvedRelativeToConfigDir covers the base directory the envfile
-// value is joined to: the config file's own directory, which is not the working
-// directory the include entries are resolved against.
+// value is joined to: the config file's own directory, not the working directory.
 func TestEnvFileResolvedRelativeToConfigDir(t *testing.T) {
 	dir := t.TempDir()
 	require.NoError(t, os.Mkdir(filepath.Join(dir, "env"), 0o700))
@@ -0,0 +1,112 @@
+package config
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	// stdinPath is the Path reading the configuration from stdin.
+	stdinPath string = "-"
+	// inlineName and stdinName stand for the file of a configuration passed inline or read
+	// from stdin in the include chains and the messages.
+	inlineName string = "<inline>"
+	stdinName  string = "<stdin>"
+)
+
+// inline reports whether the configuration is passed as bytes rather than read from Path.
+func (p *Plugin) inline() bool {
+	return p.ReadInCfg != nil && p.Type != ""
+}
+
+// fromStdin reports whether the configuration is read from stdin.
+func (p *Plugin) fromStdin() bool {
+	return !p.inline() && p.Path == stdinPath
+}
+
+// inMemory reports whether the root configuration is held in memory rather than read
+// from a file on every load, which leaves nothing to reload or watch.
+func (p *Plugin) inMemory() bool {
+	return p.inline() || p.fromStdin()
+}
+
+// root returns the path of the root configuration, which its relative include entries
+// and its envfile are resolved against: Path, a file in the directory at Path, or a file
+// in BaseDir for a configuration passed inline or read from stdin.
+func (p *Plugin) root() string {
+	switch {
+	case p.inline():
+		return filepath.Join(p.BaseDir, inlineName)
+	case p.fromStdin():
+		return filepath.Join(p.BaseDir, stdinName)
+	case p.dir:
+		return filepath.Join(p.Path, dirName)
+	default:
+		return p.Path
+	}
+}
+
+// rootName names the root configuration in the messages.
+func (p *Plugin) rootName() string {
+	switch {
+	case p.inline():
+		return inlineName
+	case p.fromStdin():
+		return stdinName
+	default:
+		return p.Path
+	}
+}
+
+// rootFile returns the file the root configuration was read from, empty for one held in
+// memory.
+func (p *Plugin) rootFile() string {
+	if p.inMemory() {
+		return ""
+	}
+
+	return p.Path
+}
+
+// readStdin reads the configuration from stdin, once: the loads that follow use the
+// content read the first time.
+func (p *Plugin) readStdin() error {
+	if !p.fromStdin() || p.stdin != nil {
+		return nil
+	}
+
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return err
+	}
+
+	p.stdin = data
+	return nil
+}
+
+// readRoot reads the root configuration, from ReadInCfg, stdin, the directory or the
+// file at Path, and returns the files it was read from.
+func (p *Plugin) readRoot() (*viper.Viper, []rootSource, error) {
+	var v *viper.Viper
+	var err error
+
+	switch {
+	case p.inline():
+		v, err = readConfig(p.ReadInCfg, p.Type)
+	case p.fromStdin():
+		v, err = readConfig(p.stdin, p.Type)
+	case p.dir:
+		return p.readDir()
+	default:
+		v, err = readFile(p.Path, p.Type)
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return v, []rootSource{{path: p.rootFile()}}, nil
+}
@@ -0,0 +1,168 @@
+package config
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInlineConfigRequiresVersion(t *testing.T) {
+	p := &Plugin{Type: "yaml", ReadInCfg: []byte("rpc:\n  listen: tcp://127.0.0.1:6391\n")}
+	assert.ErrorContains(t, p.Init(), "should contain a version")
+
+	p = &Plugin{Type: "yaml", ReadInCfg: []byte("version: 3\n")}
+	assert.ErrorContains(t, p.Init(), "version should be a string")
+}
+
+func TestInlineConfigExpandsEnv(t *testing.T) {
+	t.Setenv("RR_TEST_INLINE_LISTEN", "tcp://127.0.0.1:6393")
+
+	p := &Plugin{Type: "yaml", ReadInCfg: []byte("version: \"3\"\nrpc:\n  listen: ${RR_TEST_INLINE_LISTEN}\n")}
+	require.NoError(t, p.Init())
+
+	assert.Equal(t, "tcp://127.0.0.1:6393", p.Get("rpc.listen"))
+
+	o, ok := p.Origin("rpc.listen")
+	require.True(t, ok)
+	assert.Equal(t, Origin{Layer: LayerFile, Env: []string{"RR_TEST_INLINE_LISTEN"}}, o)
+}
+
+func TestInlineConfigIncludesResolvedAgainstBaseDir(t *testing.T) {
+	restoreEnv(t, "CONFIG_TEST_INLINE_ENVFILE_LEVEL")
+
+	dir := t.TempDir()
+	writeFile(t, dir, "http.yaml", "version: \"3\"\nhttp:\n  address: 127.0.0.1:8080\n")
+	writeFile(t, dir, ".env", "CONFIG_TEST_INLINE_ENVFILE_LEVEL=debug\n")
+
+	p := &Plugin{
+		Type:    "yaml",
+		BaseDir: dir,
+		ReadInCfg: []byte(`version: "3"
+envfile: .env
+include: [http.yaml]
+logs:
+  level: ${CONFIG_TEST_INLINE_ENVFILE_LEVEL}
+`),
+	}
+	require.NoError(t, p.Init())
+
+	assert.Equal(t, "127.0.0.1:8080", p.Get("http.address"))
+	assert.Equal(t, "debug", p.Get("logs.level"))
+}
+
+func TestInlineConfigIncludesResolvedAgainstCwd(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "http.yaml", "version: \"3\"\nhttp:\n  address: 127.0.0.1:8080\n")
+	t.Chdir(dir)
+
+	p := &Plugin{Type: "yaml", ReadInCfg: []byte("version: \"3\"\ninclude: [http.yaml]\n")}
+	require.NoError(t, p.Init())
+
+	assert.Equal(t, "127.0.0.1:8080", p.Get("http.address"))
+}
+
+func TestInlineConfigIncludeVersionMismatch(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "http.yaml", "version: \"2.7\"\nhttp:\n  address: 127.0.0.1:8080\n")
+
+	p := &Plugin{Type: "yaml", BaseDir: dir, ReadInCfg: []byte("version: \"3\"\ninclude: [http.yaml]\n")}
+	assert.ErrorContains(t, p.Init(), "version in included file must be the same as in root")
+}
+
+func TestInlineConfigProfileSection(t *testing.T) {
+	cfg := []byte(`version: "3"
+rpc:
+  listen: tcp://127.0.0.1:6391
+profiles:
+  prod:
+    rpc:
+      listen: tcp://127.0.0.1:6394
+`)
+
+	p := &Plugin{Type: "yaml", ReadInCfg: cfg, Profile: "prod"}
+	require.NoError(t, p.Init())
+	assert.Equal(t, "tcp://127.0.0.1:6394", p.Get("rpc.listen"))
+
+	p = &Plugin{Type: "yaml", ReadInCfg: cfg, Profile: "staging"}
+	assert.ErrorContains(t, p.Init(), "there is no profiles.staging section in <inline>")
+}
+
+func TestInlineConfigTakesPrecedenceOverPath(t *testing.T) {
+	path := writeYAML(t, "version: \"3\"\nrpc:\n  listen: tcp://127.0.0.1:6395\n")
+
+	p := &Plugin{Path: path, Type: "yaml", ReadInCfg: []byte(rpcConfig)}
+	require.NoError(t, p.Init())
+
+	assert.Equal(t, "tcp://127.0.0.1:6391", p.Get("rpc.listen"))
+	assert.ErrorContains(t, p.Reload(), "only a configuration read from a file can be reloaded")
+}
+
+// withStdin makes the body the content of stdin for the duration of the test.
+func withStdin(t *testing.T, body string) {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+
+	_, err = w.WriteString(body)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	prev := os.Stdin
+	os.Stdin = r
+	t.Cleanup(func() {
+		os.Stdin = prev
+		_ = r.Close()
+	})
+}
+
+func TestStdinConfig(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "http.yaml", "version: \"3\"\nhttp:\n  address: 127.0.0.1:8080\n")
+	t.Setenv("RR_TEST_STDIN_LEVEL", "debug")
+	withStdin(t, `version: "3"
+include: [http.yaml]
+rpc:
+  listen: tcp://127.0.0.1:6391
+logs:
+  level: ${RR_TEST_STDIN_LEVEL}
+`)
+
+	p := &Plugin{Path: "-", BaseDir: dir, Flags: []string{"rpc.listen=tcp://127.0.0.1:6392"}}
+	require.NoError(t, p.Init())
+
+	assert.Equal(t, "tcp://127.0.0.1:6392", p.Get("rpc.listen"))
+	assert.Equal(t, "127.0.0.1:8080", p.Get("http.address"))
+	assert.Equal(t, "debug", p.Get("logs.level"))
+
+	o, ok := p.Origin("logs.level")
+	require.True(t, ok)
+	assert.Empty(t, o.File)
+
+	// stdin is read once, there is nothing to reload from
+	assert.ErrorContains(t, p.Reload(), "only a configuration read from a file can be reloaded")
+}
+
+func TestStdinConfigFormat(t *testing.T) {
+	body := "version = \"3\"\n\n[rpc]\nlisten = \"tcp://127.0.0.1:6391\"\n"
+
+	withStdin(t, body)
+	p := &Plugin{Path: "-", Type: "toml"}
+	require.NoError(t, p.Init())
+	assert.Equal(t, "tcp://127.0.0.1:6391", p.Get("rpc.listen"))
+
+	// without Type, the format is detected
+	withStdin(t, body)
+	p = &Plugin{Path: "-"}
+	require.NoError(t, p.Init())
+	assert.Equal(t, "tcp://127.0.0.1:6391", p.Get("rpc.listen"))
+}
+
+func TestStdinConfigProfileSection(t *testing.T) {
+	withStdin(t, rpcConfig)
+
+	p := &Plugin{Path: "-", Profile: "prod"}
+	assert.ErrorContains(t, p.Init(), "there is no profiles.prod section in <stdin>")
+}
@@ -0,0 +1,93 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/roadrunner-server/errors"
+)
+
+// applyKeyFiles applies the files of KeyFilesDir to the configuration, each one setting
+// the key its path names to its content.
+func (p *Plugin) applyKeyFiles(snap *snapshot) error {
+	if p.KeyFilesDir == "" {
+		return nil
+	}
+
+	return p.applyKeyDir(snap, p.KeyFilesDir, "")
+}
+
+// applyKeyDir applies the files of the directory found at prefix, in lexical order. The
+// hidden entries are left out, such as the ..data link of a Kubernetes volume, while the
+// links are followed: the visible entries of such a volume link into ..data.
+func (p *Plugin) applyKeyDir(snap *snapshot, dir, prefix string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	// an added file, or a volume swapping its ..data link, is a reason to reload
+	snap.patterns = append(snap.patterns, filepath.Join(dir, "*"))
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+
+		path := filepath.Join(dir, name)
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+
+		key := joinKey(prefix, strings.ToLower(name))
+		switch {
+		case info.IsDir():
+			err = p.applyKeyDir(snap, path, key)
+			if err != nil {
+				return err
+			}
+		case info.Mode().IsRegular():
+			err = applyKeyFile(snap, path, key)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// applyKeyFile sets the key to the content of the file, the trailing newlines trimmed.
+// The value follows the type of the value it replaces, as a bound env variable does,
+// and stays a string for a key the configuration lacks: a secret such as 0123 is never
+// read as a number.
+func applyKeyFile(snap *snapshot, path, key string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	val := strings.TrimRight(string(data), "\r\n")
+
+	current := snap.viper.Get(key)
+	if _, section := current.(map[string]any); section {
+		return errors.Errorf("key file %s names the section %s, a section can't be replaced by a file", path, key)
+	}
+
+	var typed any = val
+	if current != nil {
+		typed, err = coerceEnv(current, val)
+		if err != nil {
+			return errors.Errorf("key file %s can't be applied to %s: %v", path, key, err)
+		}
+	}
+
+	snap.viper.Set(key, typed)
+	snap.origins.set(key, Origin{Layer: LayerKeyFile, File: path})
+	snap.files = append(snap.files, path)
+
+	return nil
+}
@@ -0,0 +1,150 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeKeyFile writes the value of the key under dir, creating the directories its path
+// names.
+func writeKeyFile(t *testing.T, dir, key, val string) string {
+	t.Helper()
+
+	path := filepath.Join(dir, filepath.FromSlash(key))
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o700))
+	require.NoError(t, os.WriteFile(path, []byte(val), 0o600))
+
+	return path
+}
+
+func TestKeyFilesLayerOverFile(t *testing.T) {
+	dir := t.TempDir()
+	workers := writeKeyFile(t, dir, "http/pool/num_workers", "8\n")
+	writeKeyFile(t, dir, "http/pool/debug", "true")
+	writeKeyFile(t, dir, "kv/redis/password", "0123\r\n\n")
+	writeKeyFile(t, dir, "rpc/listen", "tcp://127.0.0.1:6392\n")
+
+	p := &Plugin{Path: writeYAML(t, `version: "3"
+rpc:
+  listen: tcp://127.0.0.1:6391
+http:
+  address: 127.0.0.1:8080
+  pool:
+    num_workers: 2
+    debug: false
+`), KeyFilesDir: dir}
+	require.NoError(t, p.Init())
+
+	assert.Equal(t, 8, p.Get("http.pool.num_workers"))
+	assert.Equal(t, true, p.Get("http.pool.debug"))
+	assert.Equal(t, "tcp://127.0.0.1:6392", p.Get("rpc.listen"))
+	// the keys the file sets next to them survive
+	assert.Equal(t, "127.0.0.1:8080", p.Get("http.address"))
+	// a key the configuration lacks stays a string
+	assert.Equal(t, "0123", p.Get("kv.redis.password"))
+
+	o, ok := p.Origin("http.pool.num_workers")
+	require.True(t, ok)
+	assert.Equal(t, Origin{Layer: LayerKeyFile, File: workers}, o)
+
+	var pool struct {
+		NumWorkers int `mapstructure:"num_workers"`
+	}
+	require.NoError(t, p.UnmarshalKey("http.pool", &pool))
+	assert.Equal(t, 8, pool.NumWorkers)
+}
+
+// TestKeyFilesOverrideIncludesAndProfile checks that a secret mount is never shadowed by
+// a file: neither an included one nor the profile.
+func TestKeyFilesOverrideIncludesAndProfile(t *testing.T) {
+	keys := t.TempDir()
+	writeKeyFile(t, keys, "http/pool/num_workers", "32\n")
+	writeKeyFile(t, keys, "http/address", "127.0.0.1:8081\n")
+
+	dir := t.TempDir()
+	sub := writeFile(t, dir, "http.yaml", "version: \"3\"\nhttp:\n  address: 127.0.0.1:8080\n  pool:\n    num_workers: 2\n")
+	root := rootWithIncludes(t, dir, rpcConfigBody+"profiles:\n  prod:\n    http:\n      address: 127.0.0.1:8082\n", sub)
+
+	p := &Plugin{Path: root, KeyFilesDir: keys, Profile: "prod"}
+	require.NoError(t, p.Init())
+
+	assert.Equal(t, 32, p.Get("http.pool.num_workers"))
+	assert.Equal(t, "127.0.0.1:8081", p.Get("http.address"))
+
+	o, ok := p.Origin("http.pool.num_workers")
+	require.True(t, ok)
+	assert.Equal(t, LayerKeyFile, o.Layer)
+}
+
+func TestKeyFilesOverriddenByEnvAndFlags(t *testing.T) {
+	dir := t.TempDir()
+	writeKeyFile(t, dir, "rpc/listen", "tcp://127.0.0.1:6392")
+	writeKeyFile(t, dir, "http/address", "127.0.0.1:8081")
+	t.Setenv("RR_TEST_KEYFILE_HTTP__ADDRESS", "127.0.0.1:8082")
+
+	p := &Plugin{
+		Path:        writeYAML(t, rpcConfig),
+		KeyFilesDir: dir,
+		EnvPrefix:   "RR_TEST_KEYFILE",
+		Flags:       []string{"rpc.listen=tcp://127.0.0.1:6393"},
+	}
+	require.NoError(t, p.Init())
+
+	assert.Equal(t, "tcp://127.0.0.1:6393", p.Get("rpc.listen"))
+	assert.Equal(t, "127.0.0.1:8082", p.Get("http.address"))
+}
+
+// TestKeyFilesProjectedVolumeLayout covers the layout Kubernetes mounts a projected
+// volume with: the visible entries link into a hidden ..data directory.
+func TestKeyFilesProjectedVolumeLayout(t *testing.T) {
+	dir := t.TempDir()
+	writeKeyFile(t, dir, "..2026_10_17_00_00_00.000000000/rpc/listen", "tcp://127.0.0.1:6392\n")
+	require.NoError(t, os.Symlink("..2026_10_17_00_00_00.000000000", filepath.Join(dir, "..data")))
+	require.NoError(t, os.Symlink(filepath.Join("..data", "rpc"), filepath.Join(dir, "rpc")))
+
+	p := &Plugin{Path: writeYAML(t, rpcConfig), KeyFilesDir: dir}
+	require.NoError(t, p.Init())
+
+	assert.Equal(t, "tcp://127.0.0.1:6392", p.Get("rpc.listen"))
+	assert.True(t, p.isWatched(filepath.Join(dir, "..data")))
+}
+
+func TestKeyFilesReload(t *testing.T) {
+	dir := t.TempDir()
+	listen := writeKeyFile(t, dir, "rpc/listen", "tcp://127.0.0.1:6392")
+
+	p := &Plugin{Path: writeYAML(t, rpcConfig), KeyFilesDir: dir}
+	require.NoError(t, p.Init())
+	assert.True(t, p.isWatched(listen))
+
+	rewrite(t, listen, "tcp://127.0.0.1:6393\n")
+	require.NoError(t, p.Reload())
+	assert.Equal(t, "tcp://127.0.0.1:6393", p.Get("rpc.listen"))
+}
+
+func TestKeyFilesErrors(t *testing.T) {
+	t.Run("missing directory", func(t *testing.T) {
+		p := &Plugin{Path: writeYAML(t, rpcConfig), KeyFilesDir: filepath.Join(t.TempDir(), "absent")}
+		assert.ErrorContains(t, p.Init(), "no such file")
+	})
+
+	t.Run("section", func(t *testing.T) {
+		dir := t.TempDir()
+		writeKeyFile(t, dir, "rpc", "tcp://127.0.0.1:6392")
+
+		p := &Plugin{Path: writeYAML(t, rpcConfig), KeyFilesDir: dir}
+		assert.ErrorContains(t, p.Init(), "a section can't be replaced by a file")
+	})
+
+	t.Run("mistyped", func(t *testing.T) {
+		dir := t.TempDir()
+		writeKeyFile(t, dir, "http/pool/num_workers", "many")
+
+		p := &Plugin{Path: writeYAML(t, "version: \"3\"\nhttp:\n  pool:\n    num_workers: 2\n"), KeyFilesDir: dir}
+		assert.ErrorContains(t, p.Init(), "expected an integer, got `many`")
+	})
+}
@@ -0,0 +1,121 @@
+package config
+
+import (
+	"maps"
+	"reflect"
+
+	"github.com/roadrunner-server/errors"
+)
+
+// ListStrategy selects how a list of an included file is combined with the list the
+// configuration already holds under the same key.
+type ListStrategy string
+
+const (
+	// ListReplace replaces the list, it's the default.
+	ListReplace ListStrategy = "replace"
+	// ListAppend appends the items of the included list.
+	ListAppend ListStrategy = "append"
+	// ListMergeByKey merges the sections of both lists carrying the same value under
+	// MergeKey, and appends the ones that have no match.
+	ListMergeByKey ListStrategy = "merge"
+
+	// defaultMergeKey identifies the items of the lists merged by ListMergeByKey.
+	defaultMergeKey string = "name"
+)
+
+// merger deep merges an included configuration over the one built so far: the
+// sections are merged key by key, the lists according to the strategy and any other
+// value is replaced.
+type merger struct {
+	lists ListStrategy
+	key   string
+}
+
+func (p *Plugin) merger() (merger, error) {
+	m := merger{lists: p.ListMerge, key: p.MergeKey}
+	if m.lists == "" {
+		m.lists = ListReplace
+	}
+
+	if m.key == "" {
+		m.key = defaultMergeKey
+	}
+
+	switch m.lists {
+	case ListReplace, ListAppend, ListMergeByKey:
+		return m, nil
+	default:
+		return m, errors.Errorf("unknown list merge strategy `%s`, supported strategies are: replace, append, merge", m.lists)
+	}
+}
+
+// merge returns src merged over dst. Neither of them is modified, the sections of dst
+// are copied before being merged into.
+func (m merger) merge(dst, src any) any {
+	srcMap, srcIsMap := src.(map[string]any)
+	dstMap, dstIsMap := dst.(map[string]any)
+	if srcIsMap && dstIsMap {
+		out := maps.Clone(dstMap)
+		for key, val := range srcMap {
+			out[key] = m.merge(out[key], val)
+		}
+
+		return out
+	}
+
+	srcList, srcIsList := asSlice(src)
+	dstList, dstIsList := asSlice(dst)
+	if !srcIsList || !dstIsList {
+		return src
+	}
+
+	switch m.lists { //nolint:exhaustive
+	case ListAppend:
+		return append(dstList, srcList...)
+	case ListMergeByKey:
+		return m.mergeByKey(dstList, srcList)
+	default:
+		return src
+	}
+}
+
+// mergeByKey merges every section of src into the section of dst identified by the
+// same key value, the items without a match are appended.
+func (m merger) mergeByKey(dst, src []any) []any {
+	out := dst
+	for _, item := range src {
+		id, ok := m.id(item)
+		if !ok {
+			out = append(out, item)
+			continue
+		}
+
+		matched := false
+		for i := range out {
+			if other, ok := m.id(out[i]); ok && reflect.DeepEqual(id, other) {
+				out[i] = m.merge(out[i], item)
+				matched = true
+				break
+			}
+		}
+
+		if !matched {
+			out = append(out, item)
+		}
+	}
+
+	return out
+}
+
+// id returns the value identifying a list item, which has to be a section holding the
+// merge key.
+func (m merger) id(item any) (any, bool) {
+	section, ok := item.(map[string]any)
+	if !ok {
+		return nil, false
+	}
+
+	id, ok := section[m.key]
+	return id, ok
+}
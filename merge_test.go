@@ -0,0 +1,172 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const overlayRoot = `http:
+  address: 127.0.0.1:8080
+  middleware: [gzip]
+  pool:
+    num_workers: 2
+    max_jobs: 100
+jobs:
+  pipelines:
+    - name: emails
+      driver: memory
+      priority: 10
+    - name: reports
+      driver: memory
+`
+
+const overlay = `version: "3"
+http:
+  middleware: [headers]
+  pool:
+    num_workers: 4
+jobs:
+  pipelines:
+    - name: emails
+      priority: 1
+    - name: invoices
+      driver: amqp
+`
+
+// TestIncludeDeepMerges checks that an include setting a single nested key leaves the
+// rest of the section alone, for Get as well as for UnmarshalKey.
+func TestIncludeDeepMerges(t *testing.T) {
+	dir := t.TempDir()
+	sub := writeFile(t, dir, "overlay.yaml", overlay)
+
+	p := &Plugin{Path: rootWithIncludes(t, dir, overlayRoot, sub)}
+	require.NoError(t, p.Init())
+
+	assert.Equal(t, 4, p.Get("http.pool.num_workers"))
+	assert.Equal(t, 100, p.Get("http.pool.max_jobs"))
+	assert.Equal(t, "127.0.0.1:8080", p.Get("http.address"))
+
+	var out struct {
+		Address string `mapstructure:"address"`
+		Pool    struct {
+			NumWorkers int `mapstructure:"num_workers"`
+			MaxJobs    int `mapstructure:"max_jobs"`
+		} `mapstructure:"pool"`
+	}
+	require.NoError(t, p.UnmarshalKey("http", &out))
+	assert.Equal(t, "127.0.0.1:8080", out.Address)
+	assert.Equal(t, 4, out.Pool.NumWorkers)
+	assert.Equal(t, 100, out.Pool.MaxJobs)
+
+	// Lists are replaced by default.
+	assert.Equal(t, []string{"headers"}, p.Get("http.middleware"))
+}
+
+func TestIncludeListStrategies(t *testing.T) {
+	tests := []struct {
+		name       string
+		strategy   ListStrategy
+		middleware any
+		pipelines  []any
+	}{
+		{
+			name:       "replace",
+			strategy:   ListReplace,
+			middleware: []string{"headers"},
+			pipelines: []any{
+				map[string]any{"name": "emails", "priority": 1},
+				map[string]any{"name": "invoices", "driver": "amqp"},
+			},
+		},
+		{
+			name:       "append",
+			strategy:   ListAppend,
+			middleware: []any{"gzip", "headers"},
+			pipelines: []any{
+				map[string]any{"name": "emails", "driver": "memory", "priority": 10},
+				map[string]any{"name": "reports", "driver": "memory"},
+				map[string]any{"name": "emails", "priority": 1},
+				map[string]any{"name": "invoices", "driver": "amqp"},
+			},
+		},
+		{
+			name:     "merge by key",
+			strategy: ListMergeByKey,
+			// Items that aren't sections have no key to match on, they are appended.
+			middleware: []any{"gzip", "headers"},
+			pipelines: []any{
+				map[string]any{"name": "emails", "driver": "memory", "priority": 1},
+				map[string]any{"name": "reports", "driver": "memory"},
+				map[string]any{"name": "invoices", "driver": "amqp"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			sub := writeFile(t, dir, "overlay.yaml", overlay)
+
+			p := &Plugin{Path: rootWithIncludes(t, dir, overlayRoot, sub), ListMerge: tt.strategy}
+			require.NoError(t, p.Init())
+
+			assert.Equal(t, tt.middleware, p.Get("http.middleware"))
+			assert.Equal(t, tt.pipelines, p.Get("jobs.pipelines"))
+		})
+	}
+}
+
+func TestIncludeMergeKey(t *testing.T) {
+	dir := t.TempDir()
+	sub := writeFile(t, dir, "overlay.yaml", `version: "3"
+kv:
+  stores:
+    - id: a
+      driver: redis
+`)
+	root := rootWithIncludes(t, dir, `kv:
+  stores:
+    - id: a
+      driver: memory
+      ttl: 10
+`, sub)
+
+	p := &Plugin{Path: root, ListMerge: ListMergeByKey, MergeKey: "id"}
+	require.NoError(t, p.Init())
+
+	assert.Equal(t, []any{map[string]any{"id": "a", "driver": "redis", "ttl": 10}}, p.Get("kv.stores"))
+}
+
+func TestUnknownListStrategy(t *testing.T) {
+	dir := t.TempDir()
+	sub := writeFile(t, dir, "overlay.yaml", overlay)
+
+	p := &Plugin{Path: rootWithIncludes(t, dir, overlayRoot, sub), ListMerge: "zip"}
+
+	require.ErrorContains(t, p.Init(), "unknown list merge strategy `zip`")
+}
+
+func TestMergeLeavesInputsAlone(t *testing.T) {
+	dst := map[string]any{"pool": map[string]any{"num_workers": 2}, "list": []any{"a"}}
+	src := map[string]any{"pool": map[string]any{"max_jobs": 1}, "list": []any{"b"}}
+
+	out := merger{lists: ListAppend, key: defaultMergeKey}.merge(dst, src)
+
+	assert.Equal(t, map[string]any{
+		"pool": map[string]any{"num_workers": 2, "max_jobs": 1},
+		"list": []any{"a", "b"},
+	}, out)
+	assert.Equal(t, map[string]any{"pool": map[string]any{"num_workers": 2}, "list": []any{"a"}}, dst)
+}
+
+// TestMergeReplacesOnTypeChange covers a key holding a section on one side and a plain
+// value on the other: the included value wins as is.
+func TestMergeReplacesOnTypeChange(t *testing.T) {
+	m := merger{lists: ListAppend, key: defaultMergeKey}
+
+	assert.Equal(t, "plain", m.merge(map[string]any{"a": 1}, "plain"))
+	assert.Equal(t, map[string]any{"a": 1}, m.merge([]any{"x"}, map[string]any{"a": 1}))
+	assert.Equal(t, []any{"x"}, m.merge(nil, []any{"x"}))
+}
@@ -0,0 +1,188 @@
+package config
+
+import (
+	"io"
+	"maps"
+	"os"
+	"slices"
+
+	"github.com/roadrunner-server/errors"
+	"go.yaml.in/yaml/v3"
+)
+
+// Change is a key a migration moved or rewrote.
+type Change struct {
+	// Key is the key before the migration.
+	Key string
+	// NewKey is the key after the migration, the same as Key when only the value changed.
+	NewKey string
+	// Message tells what changed and why.
+	Message string
+}
+
+// migration turns a configuration of one version into the shape of the next one.
+type migration struct {
+	to    string
+	rules []migrationRule
+}
+
+// migrationRule rewrites the settings in place and returns the changes it made.
+type migrationRule func(settings map[string]any) []Change
+
+// migrations are keyed by the version they migrate from, a configuration is migrated
+// step by step up to the current version.
+var migrations = map[string]migration{
+	prevConfigVersion: {
+		to:    defaultConfigVersion,
+		rules: []migrationRule{pipelineOptionsToConfig},
+	},
+}
+
+// pipelineJobsKeys are the keys a jobs pipeline keeps next to its config section.
+var pipelineJobsKeys = []string{"driver", "config"}
+
+// pipelineOptionsToConfig moves the driver options of the jobs pipelines under their
+// config section, where version 3 expects them. A key the config section already
+// holds wins over the moved one.
+func pipelineOptionsToConfig(settings map[string]any) []Change {
+	jobs, _ := settings["jobs"].(map[string]any)
+	pipelines, _ := jobs["pipelines"].(map[string]any)
+
+	var changes []Change
+	for _, name := range slices.Sorted(maps.Keys(pipelines)) {
+		pipeline, ok := pipelines[name].(map[string]any)
+		if !ok {
+			continue
+		}
+
+		config, ok := pipeline["config"].(map[string]any)
+		if !ok {
+			config = make(map[string]any)
+		}
+
+		prefix := "jobs.pipelines." + name + "."
+		for _, key := range slices.Sorted(maps.Keys(pipeline)) {
+			if slices.Contains(pipelineJobsKeys, key) {
+				continue
+			}
+
+			if _, set := config[key]; !set {
+				config[key] = pipeline[key]
+			}
+			delete(pipeline, key)
+
+			changes = append(changes, Change{
+				Key:     prefix + key,
+				NewKey:  prefix + "config." + key,
+				Message: "pipeline options are set under the config section",
+			})
+		}
+
+		if len(config) > 0 {
+			pipeline["config"] = config
+		}
+	}
+
+	return changes
+}
+
+// migrate brings the settings to the current version in place, and returns the changes
+// made, the version bump included. A version with no migration is left alone.
+func migrate(settings map[string]any) []Change {
+	var changes []Change
+	for {
+		from, _ := settings[versionKey].(string)
+		m, ok := migrations[from]
+		if !ok {
+			return changes
+		}
+
+		for _, rule := range m.rules {
+			changes = append(changes, rule(settings)...)
+		}
+
+		settings[versionKey] = m.to
+		changes = append(changes, Change{
+			Key:     versionKey,
+			NewKey:  versionKey,
+			Message: "version " + from + " migrated to " + m.to,
+		})
+	}
+}
+
+// Migrations returns the changes made to bring the configuration to the shape of the
+// current version, empty when it already had it. The version itself is kept as declared.
+func (p *Plugin) Migrations() []Change {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return slices.Clone(p.migrations)
+}
+
+// MigrateFile writes the configuration file at path migrated to the current version to
+// w, as YAML, and returns the changes made. Only the file itself is migrated: the env
+// variables are not expanded and its includes are left as they are, they have to be
+// migrated on their own. The comments of the file are lost.
+func MigrateFile(path string, w io.Writer) ([]Change, error) {
+	const op = errors.Op("config_migrate_file")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+
+	var settings map[string]any
+	err = yaml.Unmarshal(data, &settings)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+
+	if _, ok := settings[versionKey].(string); !ok {
+		return nil, errors.E(op, errors.Str("rr configuration file should contain a version e.g: version: \"2.7\""))
+	}
+
+	changes := migrate(settings)
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	err = enc.Encode(settings)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+
+	err = enc.Close()
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+
+	return changes, nil
+}
+
+// applyMigrations migrates the configuration of the snapshot, carrying the origins of
+// the moved keys over to their new place. The version is kept as declared, it tells the
+// file apart from a migrated one and a reload may not change it.
+func applyMigrations(snap *snapshot) error {
+	settings := snap.viper.AllSettings()
+	declared := settings[versionKey]
+	changes := slices.DeleteFunc(migrate(settings), func(c Change) bool { return c.Key == versionKey })
+	if len(changes) == 0 {
+		return nil
+	}
+
+	settings[versionKey] = declared
+
+	v, err := rebuild(snap.viper, settings)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range changes {
+		if c.NewKey != c.Key {
+			snap.origins.rename(c.Key, c.NewKey)
+		}
+	}
+
+	snap.viper = v
+	snap.migrations = changes
+
+	return nil
+}
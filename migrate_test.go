@@ -0,0 +1,106 @@
+package config
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const legacyJobsConfig = `version: "2.7"
+jobs:
+  num_pollers: 10
+  pipelines:
+    emails:
+      driver: memory
+      priority: 10
+      prefetch: 1000
+    reports:
+      driver: amqp
+      queue: reports
+      config:
+        queue: overridden
+    migrated:
+      driver: memory
+      config:
+        priority: 1
+`
+
+var legacyJobsChanges = []Change{
+	{Key: "jobs.pipelines.emails.prefetch", NewKey: "jobs.pipelines.emails.config.prefetch", Message: "pipeline options are set under the config section"},
+	{Key: "jobs.pipelines.emails.priority", NewKey: "jobs.pipelines.emails.config.priority", Message: "pipeline options are set under the config section"},
+	{Key: "jobs.pipelines.reports.queue", NewKey: "jobs.pipelines.reports.config.queue", Message: "pipeline options are set under the config section"},
+}
+
+func TestMigrateInMemory(t *testing.T) {
+	p := initFromYAML(t, legacyJobsConfig)
+
+	assert.Equal(t, map[string]any{
+		"driver": "memory",
+		"config": map[string]any{"priority": 10, "prefetch": 1000},
+	}, p.Get("jobs.pipelines.emails"))
+	// the config section wins over a key it already holds
+	assert.Equal(t, "overridden", p.Get("jobs.pipelines.reports.config.queue"))
+	assert.False(t, p.Has("jobs.pipelines.reports.queue"))
+	assert.Equal(t, 10, p.Get("jobs.num_pollers"))
+	// the version is kept as declared
+	assert.Equal(t, "2.7", p.Get("version"))
+
+	assert.Equal(t, legacyJobsChanges, p.Migrations())
+
+	o, ok := p.Origin("jobs.pipelines.emails.config.priority")
+	require.True(t, ok)
+	assert.Equal(t, 7, o.Line)
+}
+
+func TestNoMigrationForCurrentVersion(t *testing.T) {
+	p := initFromYAML(t, `version: "3"
+jobs:
+  pipelines:
+    emails:
+      driver: memory
+      priority: 10
+`)
+
+	assert.Empty(t, p.Migrations())
+	assert.Equal(t, 10, p.Get("jobs.pipelines.emails.priority"))
+}
+
+func TestMigrateFile(t *testing.T) {
+	var out bytes.Buffer
+	changes, err := MigrateFile(writeYAML(t, legacyJobsConfig), &out)
+	require.NoError(t, err)
+
+	assert.Equal(t, append(legacyJobsChanges, Change{Key: "version", NewKey: "version", Message: "version 2.7 migrated to 3"}), changes)
+	assert.YAMLEq(t, `version: "3"
+jobs:
+  num_pollers: 10
+  pipelines:
+    emails:
+      driver: memory
+      config:
+        priority: 10
+        prefetch: 1000
+    reports:
+      driver: amqp
+      config:
+        queue: overridden
+    migrated:
+      driver: memory
+      config:
+        priority: 1
+`, out.String())
+
+	// the migrated file loads with no migration left to do
+	p := initFromYAML(t, out.String())
+	assert.Empty(t, p.Migrations())
+}
+
+func TestMigrateFileErrors(t *testing.T) {
+	_, err := MigrateFile(writeYAML(t, "rpc:\n  listen: tcp://127.0.0.1:6001\n"), &bytes.Buffer{})
+	require.ErrorContains(t, err, "should contain a version")
+
+	_, err = MigrateFile("/nonexistent/.rr.yaml", &bytes.Buffer{})
+	require.Error(t, err)
+}
@@ -0,0 +1,168 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// Layer names the source a configuration value was taken from.
+type Layer string
+
+const (
+	// LayerDefault is a default value registered by a plugin.
+	LayerDefault Layer = "default"
+	// LayerFile is the root configuration file.
+	LayerFile Layer = "file"
+	// LayerProfile is the section or the file of the active profile.
+	LayerProfile Layer = "profile"
+	// LayerInclude is a file listed under the include key.
+	LayerInclude Layer = "include"
+	// LayerKeyFile is a file of KeyFilesDir.
+	LayerKeyFile Layer = "key_file"
+	// LayerEnv is an env variable bound through EnvPrefix.
+	LayerEnv Layer = "env"
+	// LayerFlag is a -o flag.
+	LayerFlag Layer = "flag"
+	// LayerOverwrite is a value set at runtime through Overwrite.
+	LayerOverwrite Layer = "overwrite"
+)
+
+// Origin describes where a configuration value came from.
+type Origin struct {
+	Layer Layer
+	// File is the file the value was read from, set for the file, include and key file
+	// layers.
+	File string
+	// Line and Column locate the key in File, they are zero when the format of the file
+	// carries no positions.
+	Line   int
+	Column int
+	// Flag is the flag that set the value, as it was passed.
+	Flag string
+	// Env lists the environment variables referenced by the value, in order.
+	Env []string
+}
+
+func (o Origin) String() string {
+	var sb strings.Builder
+	sb.WriteString(string(o.Layer))
+
+	switch {
+	case o.File != "" && o.Line > 0:
+		fmt.Fprintf(&sb, " %s:%d:%d", o.File, o.Line, o.Column)
+	case o.File != "":
+		sb.WriteString(" " + o.File)
+	case o.Flag != "":
+		fmt.Fprintf(&sb, " `%s`", o.Flag)
+	}
+
+	if len(o.Env) > 0 {
+		sb.WriteString(" (env: " + strings.Join(o.Env, ", ") + ")")
+	}
+
+	return sb.String()
+}
+
+// Origin returns where the value of the key came from. Only the keys holding a value
+// are tracked, a section such as `rpc` has no origin of its own.
+func (p *Plugin) Origin(key string) (Origin, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	o, ok := p.origins[strings.ToLower(key)]
+	return o, ok
+}
+
+// origins maps the keys of a configuration to the source of their values. Later
+// layers replace the entries of the earlier ones as they override their values.
+type origins map[string]Origin
+
+// set records the origin of the key, dropping the entries of the keys nested under it:
+// a value replacing a whole section replaces the origins of its keys as well.
+func (o origins) set(key string, origin Origin) {
+	key = strings.ToLower(key)
+	prefix := key + "."
+	maps.DeleteFunc(o, func(k string, _ Origin) bool {
+		return strings.HasPrefix(k, prefix)
+	})
+
+	o[key] = origin
+}
+
+// drop forgets the key and the keys nested under it, once removed from the configuration.
+func (o origins) drop(key string) {
+	key = strings.ToLower(key)
+	prefix := key + "."
+	maps.DeleteFunc(o, func(k string, _ Origin) bool {
+		return k == key || strings.HasPrefix(k, prefix)
+	})
+}
+
+// rename moves the origins of the key, and of the keys nested under it, to a new key.
+func (o origins) rename(from, to string) {
+	from, to = strings.ToLower(from), strings.ToLower(to)
+	for key, origin := range o {
+		rest, ok := strings.CutPrefix(key, from)
+		if !ok || (rest != "" && rest[0] != '.') {
+			continue
+		}
+
+		delete(o, key)
+		o[to+rest] = origin
+	}
+}
+
+// setFile records the keys read from a configuration file along with their position in
+// it and the env variables their values referenced.
+func (o origins) setFile(layer Layer, path string, keys []string, env map[string][]string) {
+	pos := positions(path)
+	for _, key := range keys {
+		o.set(key, Origin{
+			Layer:  layer,
+			File:   path,
+			Line:   pos[key].line,
+			Column: pos[key].column,
+			Env:    env[key],
+		})
+	}
+}
+
+type position struct {
+	line, column int
+}
+
+// positions returns the position of every key in a YAML file. A file that isn't YAML
+// has no positions to report, and its keys are tracked without them.
+func positions(path string) map[string]position {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	var doc yaml.Node
+	if yaml.Unmarshal(data, &doc) != nil || len(doc.Content) == 0 {
+		return nil
+	}
+
+	out := make(map[string]position)
+	walkPositions(doc.Content[0], "", out)
+
+	return out
+}
+
+func walkPositions(node *yaml.Node, prefix string, out map[string]position) {
+	if node.Kind != yaml.MappingNode {
+		return
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, val := node.Content[i], node.Content[i+1]
+		name := joinKey(prefix, strings.ToLower(key.Value))
+		out[name] = position{line: key.Line, column: key.Column}
+		walkPositions(val, name, out)
+	}
+}
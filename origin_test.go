@@ -0,0 +1,110 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOriginOfFileValues(t *testing.T) {
+	t.Setenv("CONFIG_TEST_ORIGIN_PORT", "6391")
+
+	path := writeYAML(t, `version: "3"
+rpc:
+  listen: tcp://127.0.0.1:${CONFIG_TEST_ORIGIN_PORT}
+logs:
+  level: info
+`)
+	p := &Plugin{Path: path}
+	require.NoError(t, p.Init())
+
+	o, ok := p.Origin("rpc.listen")
+	require.True(t, ok)
+	assert.Equal(t, Origin{Layer: LayerFile, File: path, Line: 3, Column: 3, Env: []string{"CONFIG_TEST_ORIGIN_PORT"}}, o)
+
+	o, ok = p.Origin("LOGS.Level")
+	require.True(t, ok)
+	assert.Equal(t, Origin{Layer: LayerFile, File: path, Line: 5, Column: 3}, o)
+
+	// Sections and absent keys have no origin.
+	_, ok = p.Origin("rpc")
+	assert.False(t, ok)
+	_, ok = p.Origin("http.address")
+	assert.False(t, ok)
+}
+
+func TestOriginOfIncludedValues(t *testing.T) {
+	dir := t.TempDir()
+	sub := writeFile(t, dir, ".rr-sub.yaml", `version: "3"
+logs:
+  level: debug
+`)
+	root := rootWithIncludes(t, dir, "logs:\n  level: info\n  mode: development\n", sub)
+
+	p := &Plugin{Path: root}
+	require.NoError(t, p.Init())
+
+	o, ok := p.Origin("logs.level")
+	require.True(t, ok)
+	assert.Equal(t, Origin{Layer: LayerInclude, File: sub, Line: 3, Column: 3}, o)
+
+	o, ok = p.Origin("logs.mode")
+	require.True(t, ok)
+	assert.Equal(t, LayerFile, o.Layer)
+	assert.Equal(t, root, o.File)
+}
+
+func TestOriginOfFlagReplacingSection(t *testing.T) {
+	p := &Plugin{
+		Path:  writeYAML(t, rpcConfig+"http:\n  address: 127.0.0.1:8080\n"),
+		Flags: []string{"http=plain"},
+	}
+	require.NoError(t, p.Init())
+
+	o, ok := p.Origin("http")
+	require.True(t, ok)
+	assert.Equal(t, Origin{Layer: LayerFlag, Flag: "http=plain"}, o)
+
+	// The flag replaced the whole section, the origins of its keys are gone with it.
+	_, ok = p.Origin("http.address")
+	assert.False(t, ok)
+}
+
+func TestOriginOfFlagEnvReference(t *testing.T) {
+	flag := "rpc.listen=tcp://${CONFIG_TEST_ORIGIN_UNSET:-127.0.0.1}:6392"
+	p := &Plugin{Path: writeYAML(t, rpcConfig), Flags: []string{flag}}
+	require.NoError(t, p.Init())
+
+	o, ok := p.Origin("rpc.listen")
+	require.True(t, ok)
+	assert.Equal(t, Origin{Layer: LayerFlag, Flag: flag, Env: []string{"CONFIG_TEST_ORIGIN_UNSET"}}, o)
+}
+
+func TestOriginOfOverwrite(t *testing.T) {
+	p := initFromYAML(t, rpcConfig)
+	require.NoError(t, p.Overwrite(map[string]any{"rpc.listen": "tcp://127.0.0.1:6392"}))
+
+	o, ok := p.Origin("rpc.listen")
+	require.True(t, ok)
+	assert.Equal(t, Origin{Layer: LayerOverwrite}, o)
+}
+
+func TestOriginString(t *testing.T) {
+	tests := []struct {
+		name   string
+		origin Origin
+		want   string
+	}{
+		{name: "file position", origin: Origin{Layer: LayerFile, File: ".rr.yaml", Line: 3, Column: 5}, want: "file .rr.yaml:3:5"},
+		{name: "file without a position", origin: Origin{Layer: LayerInclude, File: "a.json"}, want: "include a.json"},
+		{name: "flag with env", origin: Origin{Layer: LayerFlag, Flag: "a=$B", Env: []string{"B"}}, want: "flag `a=$B` (env: B)"},
+		{name: "bare layer", origin: Origin{Layer: LayerOverwrite}, want: "overwrite"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.origin.String())
+		})
+	}
+}
@@ -1,14 +1,18 @@
 package config
 
 import (
-	"bytes"
 	"fmt"
-	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/roadrunner-server/errors"
 	"github.com/spf13/viper"
+	"go.uber.org/zap"
 )
 
 const (
@@ -19,104 +23,358 @@ const (
 
 	defaultConfigVersion string = "3"
 	prevConfigVersion    string = "2.7"
-
-	// default envs
-	envDefault = ":-"
 )
 
 type Plugin struct {
 	viper *viper.Viper
-	Path  string
+	// Path is the configuration file, - reads the configuration from stdin once, in the
+	// format Type tells or the one its content reads as. A directory holds the files of
+	// the configuration, such as a Kubernetes ConfigMap mount: its yaml, json, toml and
+	// hcl files are deep merged in lexical order, the hidden ones left out, and the ones
+	// declaring a version must declare the same one.
+	Path string
 	// Deprecated: Prefix is deprecated and will be removed in the next major version.
-	Prefix    string
-	Type      string
+	Prefix string
+	// Type is the format of the configuration: yaml, json, toml or hcl. It's required
+	// for ReadInCfg; the root file is read in the format its extension tells when empty,
+	// or the one its content reads as. An included file always goes by its extension.
+	Type string
+	// ReadInCfg is the configuration passed as bytes, read instead of the file at Path
+	// when Type is set. It's built the same way as a file: the envfile, the profile
+	// section, the env variables, the Flags, the includes and the version check apply.
 	ReadInCfg []byte
+	// BaseDir is the directory the relative include entries and the envfile of a
+	// ReadInCfg configuration, or of one read from stdin, are resolved against, the
+	// working directory when empty.
+	BaseDir string
 	// user defined Flags in the form of <option>.<key> = <value>
-	// which overwrites initial a config key
+	// which overwrites initial a config key. The value is read as YAML, a quoted one
+	// is a string; <key>+=<value> appends to a list and <key>! removes the key.
 	Flags []string
+	// IncludeRelativeToCwd resolves the relative include entries against the working
+	// directory instead of the directory of the file listing them. The working directory
+	// used to be the default: a configuration written for it, such as configs/rr.yaml
+	// listing configs/rpc.yaml, either drops the configs/ prefix from its entries or
+	// sets this option.
+	IncludeRelativeToCwd bool
+	// ListMerge selects how the lists of the included files are combined with the ones
+	// already configured: replace (the default), append, or merge by MergeKey.
+	ListMerge ListStrategy
+	// MergeKey identifies the list items merged by the merge strategy, name when empty.
+	MergeKey string
+	// EnvPrefix binds the env variables carrying it to the configuration keys: with RR,
+	// RR_HTTP__POOL__NUM_WORKERS=8 sets http.pool.num_workers, a double underscore
+	// separating the key parts. The values follow the type of the values they replace.
+	// They are applied over the file, its includes, the profile and the key files, the
+	// Flags override them. The version and the include list aren't bound. Empty
+	// disables the binding.
+	EnvPrefix string
+	// KeyFilesDir is a directory holding one value per file, such as a Kubernetes
+	// projected volume or /run/secrets: the file http/pool/num_workers sets
+	// http.pool.num_workers to its content, the trailing newlines trimmed. The files are
+	// applied over the file, its includes and the profile, the env variables and the
+	// Flags override them. The hidden entries are left out. Empty disables them.
+	KeyFilesDir string
+	// StrictEnv makes Init fail when a value references an undefined environment variable
+	// without a default, instead of expanding it to an empty string. A single reference
+	// is made mandatory with ${VAR:?message}, regardless of StrictEnv.
+	StrictEnv bool
+	// Profile selects the overlay layered over the root file and its includes, such as
+	// prod or staging: the profiles.<profile> section of the root file, then the
+	// .rr.<profile>.yaml file next to it, which a configuration passed inline or read
+	// from stdin has none of, then the files they include. When empty, the RR_PROFILE
+	// env variable is used.
+	Profile string
+	// StrictDeprecations makes a configuration setting a deprecated key an error once the
+	// RoadRunner version reaches the one the key is removed in, see RegisterDeprecation.
+	StrictDeprecations bool
+	// StrictUnmarshal makes UnmarshalKey and Unmarshal fail on the keys the configuration
+	// object has no field for, as UnmarshalKeyStrict and UnmarshalStrict do.
+	StrictUnmarshal bool
+	// Requirements are the keys the configuration must hold, checked by Init and on every
+	// reload. The plugins register theirs with Require.
+	Requirements []Requirement
 	// ExperimentalFeatures enables experimental features
 	ExperimentalFeatures bool
 	// Timeout ...
 	Timeout time.Duration
 	// RRVersion passed from the Endure.
 	Version string
+	// Watch enables the live reload: the root file, the included files and the envfile
+	// are watched and the whole configuration is rebuilt when any of them changes.
+	Watch bool
+	// Redact lists the patterns of the keys whose values Dump masks, a key matches when it
+	// contains a pattern. When nil, password, secret, token and dsn are masked.
+	Redact []string
+
+	// mu guards viper, files, patterns, origins, profile, envBindings and migrations,
+	// which a reload swaps while other plugins read them.
+	mu       sync.RWMutex
+	files    []string
+	patterns []string
+	origins  origins
+	profile  string
+	// envBindings are the env variables applied through EnvPrefix
+	envBindings []EnvBinding
+	migrations  []Change
+	// warnMu guards warnings, log and served, the warnings are raised by the loads as
+	// well as by the watcher
+	warnMu   sync.Mutex
+	warnings []Warning
+	log      *zap.Logger
+	served   bool
+	// readMu guards reads and touched, the keys read by the plugins with the keys under
+	// them, and the keys accessed on their own
+	readMu  sync.Mutex
+	reads   map[string]struct{}
+	touched map[string]struct{}
+	// reloadMu serializes the loads, a reload never runs next to another one.
+	reloadMu sync.Mutex
+	// envFileVars holds the variables set from the envfile, a reload may update them.
+	envFileVars map[string]struct{}
+	subscribers map[string][]Subscriber
+	// schemas are the fragments registered by the plugins, keyed by section
+	schemas map[string]*schema
+	// deprecations are the deprecated keys registered by the plugins, in order
+	deprecations []Deprecation
+	// required are the keys registered by the plugins with Require
+	required []Requirement
+	// defaults are the default values registered by the plugins, in order
+	defaults []defaults
+	watcher  *fsnotify.Watcher
+	// stdin is the configuration read from stdin
+	stdin []byte
+	// dir tells Path is a configuration directory, as found by Init
+	dir bool
 }
 
 // Init config provider.
 func (p *Plugin) Init() error {
 	const op = errors.Op("config_plugin_init")
 	p.viper = viper.New()
-	// If user provided []byte data with config, read it and ignore Path and Prefix
-	if p.ReadInCfg != nil && p.Type != "" {
-		p.viper.SetConfigType("yaml")
-		return p.viper.ReadConfig(bytes.NewBuffer(p.ReadInCfg))
+	if p.Path == "" && !p.inline() {
+		return errors.E(op, errors.Str("path should be set"))
 	}
 
-	if p.Path == "" {
-		return errors.E(op, errors.Str("path should be set"))
+	err := p.readStdin()
+	if err != nil {
+		return errors.E(op, err)
 	}
 
-	p.viper.SetConfigFile(p.Path)
-	err := p.viper.ReadInConfig()
+	p.dir = !p.inMemory() && isDir(p.Path)
+
+	snap, err := p.load()
 	if err != nil {
 		return errors.E(op, err)
 	}
 
+	p.viper = snap.viper
+	p.files = snap.files
+	p.patterns = snap.patterns
+	p.origins = snap.origins
+	p.profile = snap.profile
+	p.envBindings = snap.envBindings
+	p.migrations = snap.migrations
+	p.warn(snap.warnings...)
+
+	// RR includes the config feature by default starting from v2.7.
+	// However, this is only required for tests because, starting with v2.7, the rr-binary will pass the version automatically.
+	if p.Version == "" || p.Version == "local" {
+		p.Version = defaultConfigVersion
+	}
+
+	return nil
+}
+
+// snapshot is a configuration built by load, a reload swaps it as a whole.
+type snapshot struct {
+	viper *viper.Viper
+	// files are all the files the configuration was read from
+	files []string
+	// patterns are the include globs and the optional includes found missing, a file
+	// they match showing up is a reason to reload
+	patterns    []string
+	origins     origins
+	profile     string
+	envBindings []EnvBinding
+	// migrations are the changes made to bring the configuration to the current version
+	migrations []Change
+	// warnings are raised by the load, the plugin reports them once the load is accepted
+	warnings []Warning
+}
+
+// load builds a fresh configuration from the file at p.Path or from ReadInCfg, the
+// envfile and the included files, the profile, the key files, the bound env variables
+// and the Flags, each layer overriding the ones before it.
+func (p *Plugin) load() (*snapshot, error) {
+	v, sources, err := p.readRoot()
+	if err != nil {
+		return nil, err
+	}
+
+	v, profiles, err := takeProfiles(v)
+	if err != nil {
+		return nil, err
+	}
+
+	snap := &snapshot{viper: v, origins: make(origins), profile: p.selectedProfile()}
+	for _, src := range sources {
+		if src.path != "" {
+			snap.files = append(snap.files, src.path)
+		}
+	}
+
+	// a file added to the directory is a reason to reload
+	if p.dir {
+		snap.patterns = append(snap.patterns, filepath.Join(p.Path, "*"))
+	}
+
 	// load the .env file referenced by the 'envfile' key, if any
-	err = p.handleEnvFile()
+	envFile, err := p.handleEnvFile(v)
 	if err != nil {
-		return errors.E(op, err)
+		return nil, err
+	}
+
+	if envFile != "" {
+		snap.files = append(snap.files, envFile)
 	}
 
 	// automatically inject ENV variables using ${ENV}/$ENV pattern
-	expandEnvViper(p.viper)
-
-	// override config Flags
-	if len(p.Flags) > 0 {
-		for _, f := range p.Flags {
-			key, val, errP := parseFlag(f)
-			if errP != nil {
-				return errors.E(op, errP)
-			}
-			p.viper.Set(key, parseEnvDefault(val))
+	env := &envRefs{strict: p.StrictEnv}
+	// the include entries are read before the expansion, which keeps only the strings of
+	// a list mixing paths with sections
+	includes, err := parseIncludes(v.Get(includeKey), env)
+	if err != nil {
+		return nil, err
+	}
+
+	refs := expandEnvViper(v, env)
+	for _, src := range sources {
+		keys := v.AllKeys()
+		if src.keys != nil {
+			// the profiles are gone by now
+			keys = slices.DeleteFunc(src.keys, func(key string) bool { return !v.IsSet(key) })
 		}
+
+		snap.origins.setFile(LayerFile, src.path, keys, refs)
+	}
+
+	// the Flags setting the include list or the version decide which files are loaded
+	// and how they are checked, they apply before the files do
+	lists := []includeList{{parent: p.root(), entries: includes}}
+	err = p.applyFlags(snap, env, lists, isLoaderKey)
+	if err != nil {
+		return nil, err
 	}
 
 	// get a configuration version
 	// we should perform this check after all overrides
-	ver := p.viper.Get(versionKey)
+	ver := snap.viper.Get(versionKey)
 	if ver == nil {
-		return errors.Str("rr configuration file should contain a version e.g: version: 3")
+		return nil, errors.Str("rr configuration file should contain a version e.g: version: 3")
 	}
 
 	if _, ok := ver.(string); !ok {
-		return errors.E(op, errors.Errorf("version should be a string: `version: \"3\"`, actual type is: %T", ver))
+		return nil, errors.Errorf("version should be a string: `version: \"3\"`, actual type is: %T", ver)
 	}
 
-	// handle includes syntax
-	err = p.handleInclude(ver.(string))
+	// handle includes syntax, the included files are a part of the root
+	err = p.handleInclude(snap, lists, ver.(string), env)
 	if err != nil {
-		return errors.E(op, err)
+		return nil, err
 	}
 
-	// RR includes the config feature by default starting from v2.7.
-	// However, this is only required for tests because, starting with v2.7, the rr-binary will pass the version automatically.
-	if p.Version == "" || p.Version == "local" {
-		p.Version = defaultConfigVersion
+	// the profile is layered over the root and its includes, then come its own includes
+	if snap.profile != "" {
+		profileIncludes, errP := p.applyProfile(snap, profiles, snap.profile, ver.(string), env)
+		if errP != nil {
+			return nil, errP
+		}
+
+		err = p.handleInclude(snap, profileIncludes, ver.(string), env)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// the key files, the env variables and the Flags override the files, in this order
+	err = p.applyKeyFiles(snap)
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.bindEnv(snap)
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.applyFlags(snap, env, nil, func(key string) bool { return !isLoaderKey(key) })
+	if err != nil {
+		return nil, err
 	}
+	v = snap.viper
 
-	// configuration v2.7
+	// the plugins always see the configuration in the shape of the current version
+	err = applyMigrations(snap)
+	if err != nil {
+		return nil, err
+	}
+	v = snap.viper
+
+	// the keys the plugins renamed are moved to their new place
+	err = p.applyDeprecations(snap)
+	if err != nil {
+		return nil, err
+	}
+	v = snap.viper
+
+	// configuration v2.7, migrated in memory
 	if ver.(string) == prevConfigVersion {
-		println("please, update your configuration version from version: '2.7' to version: '3', see changes here: https://docs.roadrunner.dev/docs/general/compatibility#v3.0-configuration-and-rr-v2023.x.x")
+		snap.warnings = append(snap.warnings, Warning{
+			Kind:    WarningDeprecatedVersion,
+			Message: "please, update your configuration version from version: '2.7' to version: '3', see changes here: https://docs.roadrunner.dev/docs/general/compatibility#v3.0-configuration-and-rr-v2023.x.x",
+			Key:     versionKey,
+			Fields:  map[string]string{"version": prevConfigVersion, "migrated_keys": strconv.Itoa(len(snap.migrations))},
+		})
 	}
 
-	return nil
+	// every undefined variable is reported at once, from the root, the flags and the includes
+	err = env.err()
+	if err != nil {
+		return nil, err
+	}
+
+	// the defaults are the lowest layer, they only fill what no other layer set
+	p.applyRegisteredDefaults(snap)
+
+	// the schema sees the configuration the plugins will get
+	err = p.validateSchemas(v.AllSettings())
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.RLock()
+	err = p.checkRequirements(v.AllSettings())
+	p.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	return snap, nil
 }
 
 // Overwrite overwriting existing config with provided values
 func (p *Plugin) Overwrite(values map[string]any) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.origins == nil {
+		p.origins = make(origins)
+	}
+
 	for key, value := range values {
 		p.viper.Set(key, value)
+		p.origins.set(key, Origin{Layer: LayerOverwrite})
 	}
 
 	return nil
@@ -127,32 +385,37 @@ func (p *Plugin) Experimental() bool {
 	return p.ExperimentalFeatures
 }
 
-// UnmarshalKey reads a configuration section into a configuration object.
+// UnmarshalKey reads a configuration section into a configuration object. With
+// StrictUnmarshal, the keys of the section the object has no field for are an error.
 func (p *Plugin) UnmarshalKey(name string, out any) error {
 	const op = errors.Op("config_plugin_unmarshal_key")
-	err := p.viper.UnmarshalKey(name, &out)
-	if err != nil {
-		return errors.E(op, err)
-	}
-	return nil
+	return p.unmarshal(op, name, out, false)
 }
 
+// Unmarshal reads the whole configuration into a configuration object. With
+// StrictUnmarshal, the keys the object has no field for are an error.
 func (p *Plugin) Unmarshal(out any) error {
 	const op = errors.Op("config_plugin_unmarshal")
-	err := p.viper.Unmarshal(&out)
-	if err != nil {
-		return errors.E(op, err)
-	}
-	return nil
+	return p.unmarshal(op, "", out, false)
 }
 
 // Get raw config in the form of a config section.
 func (p *Plugin) Get(name string) any {
+	p.markRead(name)
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
 	return p.viper.Get(name)
 }
 
 // Has checks if a config section exists.
 func (p *Plugin) Has(name string) bool {
+	p.markTouched(name)
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
 	return p.viper.IsSet(name)
 }
 
@@ -202,9 +465,3 @@ func parseValue(value string) string {
 
 	return value
 }
-
-func parseEnvDefault(val string) string {
-	// tcp://127.0.0.1:${RPC_PORT:-36643}
-	// for envs like this, part would be tcp://127.0.0.1:
-	return ExpandVal(val, os.Getenv)
-}
@@ -27,22 +27,19 @@ func TestInitMissingFile(t *testing.T) {
 	require.ErrorContains(t, p.Init(), "no such file")
 }
 
-// TestInitFromInlineConfig covers the short circuit taken when the configuration
-// arrives as bytes: the file, the flags and the version check are all skipped,
-// and the version stays empty instead of falling back to the default.
+// TestInitFromInlineConfig covers a configuration arriving as bytes: it goes through
+// the same steps as a file, the flags and the version defaulting included.
 func TestInitFromInlineConfig(t *testing.T) {
 	p := &Plugin{
-		Type: "yaml",
-		ReadInCfg: []byte(`rpc:
-  listen: tcp://127.0.0.1:6391
-`),
-		Flags: []string{"rpc.listen=tcp://127.0.0.1:6392"},
+		Type:      "yaml",
+		ReadInCfg: []byte(rpcConfig),
+		Flags:     []string{"rpc.listen=tcp://127.0.0.1:6392"},
 	}
 
 	require.NoError(t, p.Init())
 
-	assert.Equal(t, "tcp://127.0.0.1:6391", p.Get("rpc.listen"))
-	assert.Empty(t, p.RRVersion())
+	assert.Equal(t, "tcp://127.0.0.1:6392", p.Get("rpc.listen"))
+	assert.Equal(t, defaultConfigVersion, p.RRVersion())
 }
 
 func TestInitInlineConfigInvalidYAML(t *testing.T) {
@@ -288,3 +285,58 @@ redis:
 
 	assert.Equal(t, []string{"localhost:2999", "localhost:2998"}, p.Get("redis.addrs"))
 }
+
+func TestRequiredEnvVarFailsInit(t *testing.T) {
+	p := &Plugin{
+		Path: writeYAML(t, `version: "3"
+rpc:
+  listen: ${CONFIG_TEST_REQUIRED_LISTEN:?set the rpc address}
+`),
+	}
+
+	err := p.Init()
+	require.ErrorContains(t, err, "undefined environment variables")
+	assert.ErrorContains(t, err, "CONFIG_TEST_REQUIRED_LISTEN (set the rpc address), referenced by: rpc.listen")
+}
+
+func TestFlagRequiredEnvVarFailsInit(t *testing.T) {
+	p := &Plugin{
+		Path:  writeYAML(t, rpcConfig),
+		Flags: []string{"rpc.listen=${CONFIG_TEST_REQUIRED_FLAG?}"},
+	}
+
+	require.ErrorContains(t, p.Init(), "CONFIG_TEST_REQUIRED_FLAG, referenced by: rpc.listen")
+}
+
+// TestStrictEnvReportsEveryUndefinedVariable checks that the strict mode gathers the
+// undefined variables of the root file, the flags and the included files in one error.
+func TestStrictEnvReportsEveryUndefinedVariable(t *testing.T) {
+	dir := t.TempDir()
+	sub := writeFile(t, dir, ".rr-sub.yaml", `version: "3"
+http:
+  address: ${CONFIG_TEST_STRICT_HOST}:8080
+`)
+	root := rootWithIncludes(t, dir, `rpc:
+  listen: tcp://${CONFIG_TEST_STRICT_HOST}:${CONFIG_TEST_STRICT_PORT}
+logs:
+  level: ${CONFIG_TEST_STRICT_LEVEL:-info}
+`, sub)
+
+	p := &Plugin{Path: root, StrictEnv: true, Flags: []string{"logs.mode=$CONFIG_TEST_STRICT_MODE"}}
+
+	err := p.Init()
+	require.ErrorContains(t, err, `undefined environment variables:
+	CONFIG_TEST_STRICT_HOST, referenced by: http.address, rpc.listen
+	CONFIG_TEST_STRICT_MODE, referenced by: logs.mode
+	CONFIG_TEST_STRICT_PORT, referenced by: rpc.listen`)
+	assert.NotContains(t, err.Error(), "CONFIG_TEST_STRICT_LEVEL")
+}
+
+func TestUndefinedEnvVarExpandsToEmptyByDefault(t *testing.T) {
+	p := initFromYAML(t, `version: "3"
+http:
+  address: ${CONFIG_TEST_LENIENT_HOST}:8080
+`)
+
+	assert.Equal(t, ":8080", p.Get("http.address"))
+}
@@ -0,0 +1,184 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/roadrunner-server/errors"
+	"github.com/spf13/viper"
+)
+
+const (
+	// envProfile selects the profile when the Profile field is empty.
+	envProfile string = "RR_PROFILE"
+	// profilesKey holds the profile sections of the root file.
+	profilesKey string = "profiles"
+)
+
+// ActiveProfile returns the profile the configuration was built with, empty when none.
+func (p *Plugin) ActiveProfile() string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.profile
+}
+
+// selectedProfile returns the profile set by the Profile field, or by the RR_PROFILE
+// env variable when the field is empty.
+func (p *Plugin) selectedProfile() string {
+	if p.Profile != "" {
+		return p.Profile
+	}
+
+	return os.Getenv(envProfile)
+}
+
+// profilePath returns the profile file of the root file at path: .rr.yaml gets
+// .rr.prod.yaml for the prod profile, config.json gets config.prod.json.
+func profilePath(path, profile string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + profile + ext
+}
+
+// takeProfiles removes the profiles section from the root configuration and returns
+// it. The section is consumed by the loader, whether a profile is active or not, so
+// the plugins never see it.
+func takeProfiles(v *viper.Viper) (*viper.Viper, map[string]any, error) {
+	raw := v.Get(profilesKey)
+	if raw == nil {
+		return v, nil, nil
+	}
+
+	profiles, ok := raw.(map[string]any)
+	if !ok {
+		return nil, nil, errors.Errorf("profiles should be a section keyed by the profile name, actual type is: %T", raw)
+	}
+
+	settings := v.AllSettings()
+	delete(settings, profilesKey)
+
+	stripped, err := rebuild(v, settings)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return stripped, profiles, nil
+}
+
+// profileSection reads the section of the profile in the root file the same way an
+// included file is read: its include entries are parsed before the env expansion, and
+// the include key is left out of its settings.
+func profileSection(profiles map[string]any, profile string, env *envRefs) (*fileConfig, error) {
+	raw, ok := profiles[strings.ToLower(profile)]
+	if !ok {
+		return nil, nil
+	}
+
+	section, ok := raw.(map[string]any)
+	if !ok {
+		return nil, errors.Errorf("profile `%s` should be a section, actual type is: %T", profile, raw)
+	}
+
+	v := viper.New()
+	err := v.MergeConfigMap(section)
+	if err != nil {
+		return nil, err
+	}
+
+	includes, err := parseIncludes(v.Get(includeKey), env)
+	if err != nil {
+		return nil, err
+	}
+
+	refs := expandEnvViper(v, env)
+
+	settings := v.AllSettings()
+	delete(settings, includeKey)
+	keys := slices.DeleteFunc(v.AllKeys(), func(key string) bool { return key == includeKey })
+
+	return &fileConfig{settings: settings, keys: keys, includes: includes, env: refs}, nil
+}
+
+// applyProfile layers the profile over the root configuration: first its section under
+// the profiles key, then its file next to the root one. Both are deep merged like an
+// included file, and their include entries are returned to be applied after the ones of
+// the root. A profile with neither a section nor a file is an error, which catches a
+// misspelled name.
+func (p *Plugin) applyProfile(snap *snapshot, profiles map[string]any, profile, rootVersion string, env *envRefs) ([]includeList, error) {
+	m, err := p.merger()
+	if err != nil {
+		return nil, err
+	}
+
+	var includes []includeList
+
+	section, err := profileSection(profiles, profile, env)
+	if err != nil {
+		return nil, err
+	}
+
+	if section != nil {
+		for key, val := range section.settings {
+			snap.viper.Set(key, m.merge(snap.viper.Get(key), val))
+		}
+
+		pos := positions(p.rootFile())
+		prefix := profilesKey + "." + strings.ToLower(profile) + "."
+		for _, key := range section.keys {
+			snap.origins.set(key, Origin{
+				Layer:  LayerProfile,
+				File:   p.rootFile(),
+				Line:   pos[prefix+key].line,
+				Column: pos[prefix+key].column,
+				Env:    section.env[key],
+			})
+		}
+
+		includes = append(includes, includeList{parent: p.root(), entries: section.includes})
+	}
+
+	// a configuration held in memory or read from a directory has no file next to it
+	if p.inMemory() || p.dir {
+		if section == nil {
+			return nil, errors.Errorf("profile `%s` is not defined: there is no %s.%s section in %s", profile, profilesKey, profile, p.rootName())
+		}
+
+		return includes, nil
+	}
+
+	file := profilePath(p.Path, profile)
+	if _, err = os.Stat(file); err != nil {
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+
+		// the file may be created later on, which is a reason to reload
+		snap.patterns = append(snap.patterns, file)
+		if section == nil {
+			return nil, errors.Errorf("profile `%s` is not defined: there is no %s.%s section in %s and no %s file", profile, profilesKey, profile, p.Path, file)
+		}
+
+		return includes, nil
+	}
+
+	config, err := getConfiguration(file, env)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.version != rootVersion {
+		return nil, errors.Str("version in the profile file must be the same as in root")
+	}
+
+	for key, val := range config.settings {
+		snap.viper.Set(key, m.merge(snap.viper.Get(key), val))
+	}
+
+	snap.origins.setFile(LayerProfile, file, config.keys, config.env)
+	snap.files = append(snap.files, file)
+	includes = append(includes, includeList{parent: file, entries: config.includes})
+
+	return includes, nil
+}
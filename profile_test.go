@@ -0,0 +1,186 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const profilesConfig = `version: "3"
+http:
+  address: 127.0.0.1:8080
+  pool:
+    num_workers: 2
+    max_jobs: 100
+profiles:
+  prod:
+    http:
+      address: 0.0.0.0:80
+      pool:
+        num_workers: 16
+`
+
+func TestProfileSection(t *testing.T) {
+	p := &Plugin{Path: writeYAML(t, profilesConfig), Profile: "prod"}
+	require.NoError(t, p.Init())
+
+	assert.Equal(t, "prod", p.ActiveProfile())
+	assert.Equal(t, "0.0.0.0:80", p.Get("http.address"))
+	assert.Equal(t, 16, p.Get("http.pool.num_workers"))
+	// the profile is deep merged over the root
+	assert.Equal(t, 100, p.Get("http.pool.max_jobs"))
+	// the plugins never see the profiles
+	assert.False(t, p.Has("profiles"))
+
+	o, ok := p.Origin("http.address")
+	require.True(t, ok)
+	assert.Equal(t, Origin{Layer: LayerProfile, File: p.Path, Line: 10, Column: 7}, o)
+}
+
+func TestNoProfile(t *testing.T) {
+	t.Setenv(envProfile, "")
+
+	p := initFromYAML(t, profilesConfig)
+
+	assert.Empty(t, p.ActiveProfile())
+	assert.Equal(t, "127.0.0.1:8080", p.Get("http.address"))
+	assert.False(t, p.Has("profiles"))
+}
+
+func TestProfileFromEnv(t *testing.T) {
+	t.Setenv(envProfile, "prod")
+
+	p := initFromYAML(t, profilesConfig)
+	assert.Equal(t, "prod", p.ActiveProfile())
+	assert.Equal(t, "0.0.0.0:80", p.Get("http.address"))
+
+	// the field wins over the env variable
+	dir := t.TempDir()
+	writeFile(t, dir, ".rr.staging.yaml", "version: \"3\"\nhttp:\n  address: 10.0.0.1:80\n")
+	p = &Plugin{Path: writeFile(t, dir, ".rr.yaml", profilesConfig), Profile: "staging"}
+	require.NoError(t, p.Init())
+	assert.Equal(t, "staging", p.ActiveProfile())
+	assert.Equal(t, "10.0.0.1:80", p.Get("http.address"))
+}
+
+// TestProfileOrder checks the layers: the root and its includes, then the section, then
+// the profile file, then the Flags.
+func TestProfileOrder(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, ".rr.prod.yaml", "version: \"3\"\nx: file\ny: file\nz: file\n")
+	writeFile(t, dir, "included.yaml", "version: \"3\"\nv: include\nw: include\nz: include\n")
+	root := writeFile(t, dir, ".rr.yaml", `version: "3"
+include: [included.yaml]
+w: root
+x: root
+profiles:
+  prod:
+    w: section
+    x: section
+`)
+
+	p := &Plugin{Path: root, Profile: "prod", Flags: []string{"y=flag"}}
+	require.NoError(t, p.Init())
+
+	assert.Equal(t, "include", p.Get("v"))
+	assert.Equal(t, "section", p.Get("w"))
+	assert.Equal(t, "file", p.Get("x"))
+	assert.Equal(t, "flag", p.Get("y"))
+	assert.Equal(t, "file", p.Get("z"))
+}
+
+// TestProfileOverridesRootInclude covers a base file included by the root: the profile
+// sits over it, down to a key of a nested section.
+func TestProfileOverridesRootInclude(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "base.yaml", "version: \"3\"\nhttp:\n  address: 127.0.0.1:8080\n  pool:\n    num_workers: 2\n    debug: true\n")
+	root := writeFile(t, dir, ".rr.yaml", `version: "3"
+include: [base.yaml]
+profiles:
+  prod:
+    http:
+      pool:
+        num_workers: 16
+`)
+
+	p := &Plugin{Path: root, Profile: "prod"}
+	require.NoError(t, p.Init())
+
+	assert.Equal(t, 16, p.Get("http.pool.num_workers"))
+	assert.Equal(t, true, p.Get("http.pool.debug"))
+	assert.Equal(t, "127.0.0.1:8080", p.Get("http.address"))
+
+	o, ok := p.Origin("http.pool.num_workers")
+	require.True(t, ok)
+	assert.Equal(t, LayerProfile, o.Layer)
+}
+
+func TestProfileIncludes(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "prod-extra.yaml", "version: \"3\"\nx: section-include\n")
+	writeFile(t, dir, "prod-file-extra.yaml", "version: \"3\"\ny: file-include\n")
+	writeFile(t, dir, ".rr.prod.yaml", "version: \"3\"\ninclude: [prod-file-extra.yaml]\ny: file\n")
+	root := writeFile(t, dir, ".rr.yaml", `version: "3"
+x: root
+profiles:
+  prod:
+    include: [prod-extra.yaml]
+`)
+
+	p := &Plugin{Path: root, Profile: "prod"}
+	require.NoError(t, p.Init())
+
+	assert.Equal(t, "section-include", p.Get("x"))
+	assert.Equal(t, "file-include", p.Get("y"))
+	assert.False(t, p.Has("include"))
+}
+
+func TestProfileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		profile string
+		want    string
+	}{
+		{name: "undefined profile", body: profilesConfig, profile: "prdo", want: "profile `prdo` is not defined"},
+		{name: "profiles is not a section", body: "version: \"3\"\nprofiles: [prod]\n", profile: "prod", want: "profiles should be a section"},
+		{name: "profile is not a section", body: "version: \"3\"\nprofiles:\n  prod: 1\n", profile: "prod", want: "profile `prod` should be a section"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Plugin{Path: writeYAML(t, tt.body), Profile: tt.profile}
+
+			require.ErrorContains(t, p.Init(), tt.want)
+		})
+	}
+}
+
+func TestProfileFileVersionMismatch(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, ".rr.prod.yaml", "version: \"2.7\"\n")
+
+	p := &Plugin{Path: writeFile(t, dir, ".rr.yaml", rpcConfig), Profile: "prod"}
+
+	require.ErrorContains(t, p.Init(), "version in the profile file must be the same as in root")
+}
+
+func TestWatchPicksUpProfileFile(t *testing.T) {
+	dir := t.TempDir()
+	p := &Plugin{Path: writeFile(t, dir, ".rr.yaml", profilesConfig), Profile: "prod", Watch: true}
+	require.NoError(t, p.Init())
+
+	errCh := p.Serve()
+	t.Cleanup(func() {
+		require.NoError(t, p.Stop(t.Context()))
+		assert.Empty(t, errCh)
+	})
+
+	writeFile(t, dir, ".rr.prod.yaml", "version: \"3\"\nhttp:\n  address: 0.0.0.0:443\n")
+
+	require.Eventually(t, func() bool {
+		return p.Get("http.address") == "0.0.0.0:443"
+	}, time.Second*5, time.Millisecond*20)
+}
@@ -0,0 +1,248 @@
+package config
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/roadrunner-server/errors"
+	"github.com/spf13/viper"
+)
+
+// reloadDebounce is how long the watcher waits for the file events to settle: editors
+// usually write a file in several steps, and the configuration is rebuilt only once.
+const reloadDebounce = time.Millisecond * 100
+
+// Subscriber is called after a reload with the previous and the new value of the
+// section it subscribed to.
+type Subscriber func(prev, next any)
+
+// Subscribe registers fn to be called when the section changes after a reload. The
+// section is a key in the form of Get, an empty one stands for the whole configuration.
+func (p *Plugin) Subscribe(section string, fn Subscriber) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.subscribers == nil {
+		p.subscribers = make(map[string][]Subscriber)
+	}
+
+	p.subscribers[section] = append(p.subscribers[section], fn)
+}
+
+// Reload rebuilds the configuration from its files, with the envfile, the env variables
+// and the Flags applied again. A configuration that fails to load, or that changes the
+// version, is rejected and the current one is kept. On success, the subscribers of
+// every section that changed are called with its previous and its new value.
+//
+// Values set with Overwrite do not survive a reload.
+func (p *Plugin) Reload() error {
+	const op = errors.Op("config_plugin_reload")
+	if p.Path == "" || p.inMemory() {
+		return errors.E(op, errors.Str("only a configuration read from a file can be reloaded"))
+	}
+
+	p.reloadMu.Lock()
+	defer p.reloadMu.Unlock()
+
+	snap, err := p.load()
+	if err != nil {
+		return errors.E(op, err)
+	}
+
+	v := snap.viper
+	p.mu.Lock()
+	prev := p.viper
+	if prev.GetString(versionKey) != v.GetString(versionKey) {
+		p.mu.Unlock()
+		return errors.E(op, errors.Errorf("version can't be changed by a reload: `%s` -> `%s`", prev.GetString(versionKey), v.GetString(versionKey)))
+	}
+
+	p.viper = v
+	p.files = snap.files
+	p.patterns = snap.patterns
+	p.origins = snap.origins
+	p.profile = snap.profile
+	p.envBindings = snap.envBindings
+	p.migrations = snap.migrations
+	w := p.watcher
+
+	changed := make(map[string][]Subscriber, len(p.subscribers))
+	for section, subs := range p.subscribers {
+		changed[section] = append([]Subscriber(nil), subs...)
+	}
+	p.mu.Unlock()
+
+	p.warn(snap.warnings...)
+
+	// subscribers run without the lock held, so they may read the new configuration
+	for section, subs := range changed {
+		before, after := sectionOf(prev, section), sectionOf(v, section)
+		if reflect.DeepEqual(before, after) {
+			continue
+		}
+
+		for _, fn := range subs {
+			fn(before, after)
+		}
+	}
+
+	// a reload may bring new included files in
+	if w != nil {
+		watchFiles(w, append(snap.files, snap.patterns...))
+	}
+
+	return nil
+}
+
+// Serve starts watching the configuration files when Watch is set. Every plugin is
+// initialized by then: the keys they require are checked, and the parts of the
+// configuration none of them used are reported. The warnings raised so far go to stderr,
+// unless a logger was set.
+func (p *Plugin) Serve() chan error {
+	p.reportUnused()
+	p.flushWarnings()
+
+	errCh := make(chan error, 1)
+	// the plugins registered their requirements by now
+	if p.viper != nil {
+		err := p.ValidateRequirements()
+		if err != nil {
+			errCh <- err
+			return errCh
+		}
+	}
+
+	if !p.Watch || p.Path == "" || p.inMemory() {
+		return errCh
+	}
+
+	const op = errors.Op("config_plugin_serve")
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		errCh <- errors.E(op, err)
+		return errCh
+	}
+
+	p.mu.Lock()
+	p.watcher = w
+	files := append(slices.Clone(p.files), p.patterns...)
+	p.mu.Unlock()
+
+	watchFiles(w, files)
+
+	go p.watch(w)
+
+	return errCh
+}
+
+// Stop stops watching the configuration files.
+func (p *Plugin) Stop(context.Context) error {
+	p.mu.Lock()
+	w := p.watcher
+	p.watcher = nil
+	p.mu.Unlock()
+
+	if w == nil {
+		return nil
+	}
+
+	return w.Close()
+}
+
+// watch reloads the configuration once the events for the watched files settle. A
+// rejected reload keeps the server running with the configuration it has.
+func (p *Plugin) watch(w *fsnotify.Watcher) {
+	timer := time.NewTimer(reloadDebounce)
+	timer.Stop()
+	defer timer.Stop()
+
+	for {
+		select {
+		case ev, ok := <-w.Events:
+			if !ok {
+				return
+			}
+
+			if !p.isWatched(ev.Name) {
+				continue
+			}
+
+			timer.Reset(reloadDebounce)
+		case _, ok := <-w.Errors:
+			if !ok {
+				return
+			}
+		case <-timer.C:
+			err := p.Reload()
+			if err != nil {
+				p.warn(Warning{
+					Kind:    WarningReloadRejected,
+					Message: "configuration reload rejected, the previous configuration is kept",
+					Fields:  map[string]string{"error": err.Error()},
+				})
+			}
+		}
+	}
+}
+
+// configMapData is the link a Kubernetes ConfigMap mount points its files through, an
+// update swaps it for a link to the new revision.
+const configMapData string = "..data"
+
+// isWatched reports whether name is one of the files the configuration was built from,
+// or a file an include pattern would bring in. The ..data link next to such a file is
+// watched as well: a ConfigMap update only swaps that link, no event names the file.
+func (p *Plugin) isWatched(name string) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	name = absPath(name)
+	swapped := filepath.Base(name) == configMapData
+	for _, f := range p.files {
+		f = absPath(f)
+		if f == name || swapped && filepath.Dir(f) == filepath.Dir(name) {
+			return true
+		}
+	}
+
+	for _, pattern := range p.patterns {
+		if ok, _ := filepath.Match(absPath(pattern), name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// watchFiles watches the directories of the files rather than the files themselves:
+// editors replace a file instead of writing to it, and ConfigMap updates swap the link
+// it goes through, either of which would silently end a watch placed on the file. A pattern is watched through its directory
+// as well, unless the directory is a pattern itself.
+func watchFiles(w *fsnotify.Watcher, files []string) {
+	for _, f := range files {
+		// a directory that can't be watched only loses the live reload, it's not fatal
+		_ = w.Add(filepath.Dir(absPath(f)))
+	}
+}
+
+func absPath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.Clean(path)
+	}
+
+	return abs
+}
+
+// sectionOf returns the value of the section, an empty name returns the whole configuration.
+func sectionOf(v *viper.Viper, section string) any {
+	if section == "" {
+		return v.AllSettings()
+	}
+
+	return v.Get(section)
+}
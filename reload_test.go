@@ -0,0 +1,222 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rewrite replaces the content of the file at path.
+func rewrite(t *testing.T, path, body string) {
+	t.Helper()
+
+	require.NoError(t, os.WriteFile(path, []byte(body), 0o600))
+}
+
+func TestReloadNotifiesChangedSections(t *testing.T) {
+	path := writeYAML(t, rpcConfig+"logs:\n  level: info\n")
+	p := &Plugin{Path: path}
+	require.NoError(t, p.Init())
+
+	var prev, next any
+	p.Subscribe("rpc", func(before, after any) {
+		prev, next = before, after
+	})
+
+	logsCalled := false
+	p.Subscribe("logs", func(_, _ any) {
+		logsCalled = true
+	})
+
+	rewrite(t, path, `version: "3"
+rpc:
+  listen: tcp://127.0.0.1:6392
+logs:
+  level: info
+`)
+	require.NoError(t, p.Reload())
+
+	assert.Equal(t, map[string]any{"listen": "tcp://127.0.0.1:6391"}, prev)
+	assert.Equal(t, map[string]any{"listen": "tcp://127.0.0.1:6392"}, next)
+	assert.Equal(t, "tcp://127.0.0.1:6392", p.Get("rpc.listen"))
+
+	// An unchanged section is not reported.
+	assert.False(t, logsCalled)
+}
+
+func TestReloadWholeConfigSubscriber(t *testing.T) {
+	path := writeYAML(t, rpcConfig)
+	p := &Plugin{Path: path}
+	require.NoError(t, p.Init())
+
+	var next any
+	p.Subscribe("", func(_, after any) {
+		next = after
+	})
+
+	rewrite(t, path, rpcConfig+"logs:\n  level: debug\n")
+	require.NoError(t, p.Reload())
+
+	require.IsType(t, map[string]any{}, next)
+	assert.Equal(t, map[string]any{"level": "debug"}, next.(map[string]any)["logs"])
+}
+
+// TestReloadReappliesPipeline checks that the Flags and the env expansion are applied
+// to the reloaded files just as they were at Init.
+func TestReloadReappliesPipeline(t *testing.T) {
+	t.Setenv("CONFIG_TEST_RELOAD_LEVEL", "warn")
+
+	path := writeYAML(t, rpcConfig)
+	p := &Plugin{Path: path, Flags: []string{"rpc.listen=tcp://127.0.0.1:6399"}}
+	require.NoError(t, p.Init())
+
+	rewrite(t, path, rpcConfig+"logs:\n  level: ${CONFIG_TEST_RELOAD_LEVEL}\n")
+	require.NoError(t, p.Reload())
+
+	assert.Equal(t, "tcp://127.0.0.1:6399", p.Get("rpc.listen"))
+	assert.Equal(t, "warn", p.Get("logs.level"))
+}
+
+func TestReloadRejectsBrokenConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{name: "invalid yaml", body: "rpc: [broken\n", want: "yaml"},
+		{name: "no version", body: "rpc:\n  listen: tcp://127.0.0.1:6392\n", want: "rr configuration file should contain a version"},
+		{name: "non-string version", body: "version: 3\n", want: "version should be a string"},
+		{name: "version changed", body: "version: \"2.7\"\n", want: "version can't be changed by a reload"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeYAML(t, rpcConfig)
+			p := &Plugin{Path: path}
+			require.NoError(t, p.Init())
+
+			called := false
+			p.Subscribe("rpc", func(_, _ any) {
+				called = true
+			})
+
+			rewrite(t, path, tt.body)
+			require.ErrorContains(t, p.Reload(), tt.want)
+
+			// The previous configuration stays in place.
+			assert.Equal(t, "tcp://127.0.0.1:6391", p.Get("rpc.listen"))
+			assert.False(t, called)
+		})
+	}
+}
+
+func TestReloadFollowsIncludeAndEnvFile(t *testing.T) {
+	restoreEnv(t, "CONFIG_TEST_RELOAD_ENVFILE_LEVEL")
+
+	dir := t.TempDir()
+	env := writeFile(t, dir, ".env.test", "CONFIG_TEST_RELOAD_ENVFILE_LEVEL=info\n")
+	sub := writeFile(t, dir, ".rr-sub.yaml", `version: "3"
+rpc:
+  listen: tcp://127.0.0.1:6391
+`)
+	root := rootWithIncludes(t, dir, `envfile: ".env.test"
+logs:
+  level: ${CONFIG_TEST_RELOAD_ENVFILE_LEVEL}
+`, sub)
+
+	p := &Plugin{Path: root}
+	require.NoError(t, p.Init())
+	require.Equal(t, "info", p.Get("logs.level"))
+
+	rewrite(t, sub, `version: "3"
+rpc:
+  listen: tcp://127.0.0.1:6392
+`)
+	// A variable the envfile set is updated from the file on reload.
+	rewrite(t, env, "CONFIG_TEST_RELOAD_ENVFILE_LEVEL=debug\n")
+	require.NoError(t, p.Reload())
+
+	assert.Equal(t, "tcp://127.0.0.1:6392", p.Get("rpc.listen"))
+	assert.Equal(t, "debug", p.Get("logs.level"))
+}
+
+func TestReloadRequiresFile(t *testing.T) {
+	p := &Plugin{Type: "yaml", ReadInCfg: []byte(rpcConfig)}
+	require.NoError(t, p.Init())
+
+	require.ErrorContains(t, p.Reload(), "only a configuration read from a file can be reloaded")
+}
+
+func TestWatchReloadsOnChange(t *testing.T) {
+	path := writeYAML(t, rpcConfig)
+	p := &Plugin{Path: path, Watch: true}
+	require.NoError(t, p.Init())
+
+	var mu sync.Mutex
+	var next any
+	p.Subscribe("rpc.listen", func(_, after any) {
+		mu.Lock()
+		defer mu.Unlock()
+		next = after
+	})
+
+	errCh := p.Serve()
+	t.Cleanup(func() {
+		require.NoError(t, p.Stop(t.Context()))
+		assert.Empty(t, errCh)
+	})
+
+	rewrite(t, path, `version: "3"
+rpc:
+  listen: tcp://127.0.0.1:6392
+`)
+
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return next == "tcp://127.0.0.1:6392"
+	}, time.Second*5, time.Millisecond*20)
+}
+
+// TestWatchReloadsOnConfigMapSwap covers a Kubernetes ConfigMap update: the file is a
+// link through ..data, and the update swaps ..data for a link to the new revision.
+func TestWatchReloadsOnConfigMapSwap(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "..2026_10_17_00_00_00.000000001"), 0o700))
+	writeFile(t, filepath.Join(dir, "..2026_10_17_00_00_00.000000001"), "rr.yaml", rpcConfig)
+	require.NoError(t, os.Symlink("..2026_10_17_00_00_00.000000001", filepath.Join(dir, "..data")))
+	require.NoError(t, os.Symlink(filepath.Join("..data", "rr.yaml"), filepath.Join(dir, "rr.yaml")))
+
+	p := &Plugin{Path: filepath.Join(dir, "rr.yaml"), Watch: true}
+	require.NoError(t, p.Init())
+	assert.True(t, p.isWatched(filepath.Join(dir, "..data")))
+	assert.False(t, p.isWatched(filepath.Join(t.TempDir(), "..data")))
+
+	errCh := p.Serve()
+	t.Cleanup(func() {
+		require.NoError(t, p.Stop(t.Context()))
+		assert.Empty(t, errCh)
+	})
+
+	// the way the kubelet swaps the revision: a new link renamed over ..data
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "..2026_10_17_00_00_00.000000002"), 0o700))
+	writeFile(t, filepath.Join(dir, "..2026_10_17_00_00_00.000000002"), "rr.yaml", "version: \"3\"\nrpc:\n  listen: tcp://127.0.0.1:6392\n")
+	require.NoError(t, os.Symlink("..2026_10_17_00_00_00.000000002", filepath.Join(dir, "..data_tmp")))
+	require.NoError(t, os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")))
+
+	require.Eventually(t, func() bool {
+		return p.Get("rpc.listen") == "tcp://127.0.0.1:6392"
+	}, time.Second*5, time.Millisecond*20)
+}
+
+func TestServeWithoutWatch(t *testing.T) {
+	p := initFromYAML(t, rpcConfig)
+
+	assert.Empty(t, p.Serve())
+	assert.NoError(t, p.Stop(t.Context()))
+}
@@ -0,0 +1,176 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/roadrunner-server/errors"
+)
+
+// KeyType is the type a required key should hold.
+type KeyType string
+
+const (
+	// KeyAny accepts any value, only the presence of the key is checked.
+	KeyAny KeyType = ""
+	// KeyString is a string.
+	KeyString KeyType = "string"
+	// KeyInt is an integer, or a string holding one.
+	KeyInt KeyType = "integer"
+	// KeyNumber is a number, or a string holding one.
+	KeyNumber KeyType = "number"
+	// KeyBool is a boolean, or a string holding one.
+	KeyBool KeyType = "boolean"
+	// KeyDuration is a duration such as 10s, or a number of nanoseconds.
+	KeyDuration KeyType = "duration"
+	// KeyList is a list.
+	KeyList KeyType = "list"
+	// KeySection is a section.
+	KeySection KeyType = "section"
+)
+
+// Requirement declares a key the configuration must hold.
+type Requirement struct {
+	Key  string
+	Type KeyType
+	// Plugin names the plugin requiring the key, it's shown in the error.
+	Plugin string
+}
+
+// Require registers keys the configuration must hold. The declarations of all the
+// plugins are checked together once they are initialized, when the config plugin is
+// served, and again on every reload: a single error lists every missing or mistyped key.
+func (p *Plugin) Require(reqs ...Requirement) error {
+	const op = errors.Op("config_plugin_require")
+	for _, r := range reqs {
+		err := r.validate()
+		if err != nil {
+			return errors.E(op, err)
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.required = append(p.required, reqs...)
+
+	return nil
+}
+
+// ValidateRequirements checks the configuration against the Requirements and the keys
+// registered with Require.
+func (p *Plugin) ValidateRequirements() error {
+	const op = errors.Op("config_plugin_validate_requirements")
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	err := p.checkRequirements(p.viper.AllSettings())
+	if err != nil {
+		return errors.E(op, err)
+	}
+
+	return nil
+}
+
+// checkRequirements checks the settings against every requirement and returns all the
+// violations at once. The caller holds mu.
+func (p *Plugin) checkRequirements(settings map[string]any) error {
+	var violations []Violation
+	for _, r := range slices.Concat(p.Requirements, p.required) {
+		msg, ok := r.check(settings)
+		if ok {
+			continue
+		}
+
+		if r.Plugin != "" {
+			msg += ", required by " + r.Plugin
+		}
+
+		violations = append(violations, Violation{Key: strings.ToLower(r.Key), Message: msg})
+	}
+
+	if len(violations) > 0 {
+		return listViolations("configuration lacks required keys or has them mistyped", violations)
+	}
+
+	return nil
+}
+
+func (r Requirement) validate() error {
+	if r.Key == "" {
+		return errors.Str("required key should not be empty")
+	}
+
+	switch r.Type {
+	case KeyAny, KeyString, KeyInt, KeyNumber, KeyBool, KeyDuration, KeyList, KeySection:
+		return nil
+	default:
+		return errors.Errorf("unknown type `%s` of the required key `%s`", r.Type, r.Key)
+	}
+}
+
+// check returns what's wrong with the key in the settings, if anything.
+func (r Requirement) check(settings map[string]any) (string, bool) {
+	val, ok := lookupKey(settings, strings.ToLower(r.Key))
+	if !ok || val == nil {
+		return "required key is missing", false
+	}
+
+	if r.Type == KeyAny || holds(r.Type, val) {
+		return "", true
+	}
+
+	if str, ok := val.(string); ok {
+		return fmt.Sprintf("expected %s, got `%s`", r.Type, str), false
+	}
+
+	return fmt.Sprintf("expected %s, got %s", r.Type, jsonType(val)), false
+}
+
+// holds reports whether the value is of the type. The env variables expand to strings,
+// a string is accepted where the decoder would convert it.
+func holds(t KeyType, val any) bool {
+	str, isString := val.(string)
+
+	switch t {
+	case KeyString:
+		return isString
+	case KeyInt:
+		if isString {
+			_, err := strconv.ParseInt(strings.TrimSpace(str), 0, 64)
+			return err == nil
+		}
+		return jsonType(val) == "integer"
+	case KeyNumber:
+		if isString {
+			_, err := strconv.ParseFloat(strings.TrimSpace(str), 64)
+			return err == nil
+		}
+		_, ok := asNumber(val)
+		return ok
+	case KeyBool:
+		if isString {
+			_, err := strconv.ParseBool(str)
+			return err == nil
+		}
+		_, ok := val.(bool)
+		return ok
+	case KeyDuration:
+		if isString {
+			_, err := time.ParseDuration(str)
+			return err == nil
+		}
+		return jsonType(val) == "integer"
+	case KeyList:
+		_, ok := asSlice(val)
+		return ok
+	case KeySection:
+		_, ok := val.(map[string]any)
+		return ok
+	default:
+		return true
+	}
+}
@@ -0,0 +1,92 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const requiredConfig = `version: "3"
+http:
+  address: 127.0.0.1:8080
+  pool:
+    num_workers: ${CONFIG_TEST_REQUIRE_WORKERS:-4}
+    destroy_timeout: 10s
+    debug: true
+  middleware: [gzip]
+`
+
+func TestRequirementsAreMet(t *testing.T) {
+	p := &Plugin{
+		Path: writeYAML(t, requiredConfig),
+		Requirements: []Requirement{
+			{Key: "http", Type: KeySection},
+			{Key: "http.address", Type: KeyString},
+			// the value is an expanded string, it holds an integer
+			{Key: "http.pool.num_workers", Type: KeyInt},
+			{Key: "http.pool.destroy_timeout", Type: KeyDuration},
+			{Key: "http.pool.debug", Type: KeyBool},
+			{Key: "http.middleware", Type: KeyList},
+			{Key: "HTTP.Pool"},
+		},
+	}
+
+	require.NoError(t, p.Init())
+}
+
+func TestRequirementsAggregateViolations(t *testing.T) {
+	p := &Plugin{
+		Path: writeYAML(t, requiredConfig),
+		Requirements: []Requirement{
+			{Key: "http.pool.debug", Type: KeyInt},
+			{Key: "rpc.listen", Type: KeyString, Plugin: "rpc"},
+			{Key: "http.pool.destroy_timeout", Type: KeyNumber},
+			{Key: "http.middleware", Type: KeySection},
+		},
+	}
+
+	err := p.Init()
+	require.ErrorContains(t, err, "configuration lacks required keys or has them mistyped")
+	assert.ErrorContains(t, err, "http.pool.debug: expected integer, got boolean")
+	assert.ErrorContains(t, err, "rpc.listen: required key is missing, required by rpc")
+	assert.ErrorContains(t, err, "http.pool.destroy_timeout: expected number, got `10s`")
+	assert.ErrorContains(t, err, "http.middleware: expected section, got array")
+}
+
+// TestRequireIsCheckedOnServe checks that the keys registered by the plugins after Init
+// are checked together when the plugin is served.
+func TestRequireIsCheckedOnServe(t *testing.T) {
+	p := initFromYAML(t, requiredConfig)
+
+	require.NoError(t, p.Require(Requirement{Key: "http.address", Type: KeyString, Plugin: "http"}))
+	require.NoError(t, p.Require(
+		Requirement{Key: "kv.local.driver", Type: KeyString, Plugin: "kv"},
+		Requirement{Key: "jobs", Type: KeySection, Plugin: "jobs"},
+	))
+
+	err := <-p.Serve()
+	require.ErrorContains(t, err, "kv.local.driver: required key is missing, required by kv")
+	assert.ErrorContains(t, err, "jobs: required key is missing, required by jobs")
+	assert.NotContains(t, err.Error(), "http.address")
+}
+
+func TestRequireGuardsReload(t *testing.T) {
+	path := writeYAML(t, requiredConfig)
+	p := &Plugin{Path: path}
+	require.NoError(t, p.Init())
+	require.NoError(t, p.Require(Requirement{Key: "http.address", Type: KeyString}))
+
+	rewrite(t, path, "version: \"3\"\nhttp:\n  pool:\n    num_workers: 2\n")
+
+	require.ErrorContains(t, p.Reload(), "http.address: required key is missing")
+	assert.Equal(t, "127.0.0.1:8080", p.Get("http.address"))
+}
+
+func TestRequireInvalidDeclaration(t *testing.T) {
+	p := initFromYAML(t, requiredConfig)
+
+	require.ErrorContains(t, p.Require(Requirement{Key: "http.address", Type: "uuid"}), "unknown type `uuid` of the required key `http.address`")
+	require.ErrorContains(t, p.Require(Requirement{Type: KeyString}), "required key should not be empty")
+	require.NoError(t, p.ValidateRequirements())
+}
@@ -0,0 +1,527 @@
+package config
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/roadrunner-server/errors"
+)
+
+// coreSchema describes the sections owned by the RoadRunner core. Keys it doesn't
+// describe are left to the plugins that register their own fragments: the sections of
+// the rpc and logger plugins are left open and their values are only checked for type,
+// the allowed values of their options belong to those plugins. The root is open as well:
+// the plugins register their fragments after the configuration is loaded, so a top-level
+// typo such as rcp isn't a schema violation. UnusedKeys reports it instead, as a section
+// no plugin accessed, and Serve emits it as a warning.
+//
+//go:embed schema.json
+var coreSchema []byte
+
+var compiledCoreSchema = sync.OnceValues(func() (*schema, error) {
+	return compileSchema(coreSchema)
+})
+
+// Violation is a single mismatch between the configuration and a schema.
+type Violation struct {
+	// Key is the dotted path of the offending value, e.g. rpc.listen.
+	Key     string
+	Message string
+}
+
+func (v Violation) String() string {
+	if v.Key == "" {
+		return v.Message
+	}
+
+	return v.Key + ": " + v.Message
+}
+
+// schema is the subset of JSON Schema the configuration is checked with: type, enum,
+// properties, required, additionalProperties, items, pattern, minimum, maximum,
+// minLength, minItems and anyOf. A schema using any other keyword is rejected, as the
+// constraint it states would never be checked; the annotations are allowed.
+type schema struct {
+	Type                 schemaTypes        `json:"type"`
+	Enum                 []any              `json:"enum"`
+	Properties           map[string]*schema `json:"properties"`
+	Required             []string           `json:"required"`
+	AdditionalProperties *additional        `json:"additionalProperties"`
+	Items                *schema            `json:"items"`
+	Pattern              string             `json:"pattern"`
+	Minimum              *float64           `json:"minimum"`
+	Maximum              *float64           `json:"maximum"`
+	MinLength            *int               `json:"minLength"`
+	MinItems             *int               `json:"minItems"`
+	AnyOf                []*schema          `json:"anyOf"`
+
+	pattern *regexp.Regexp
+}
+
+// keywords are the keywords a schema may use: the ones checked and the annotations,
+// which don't constrain the value.
+var keywords = map[string]bool{
+	"type":                 true,
+	"enum":                 true,
+	"properties":           true,
+	"required":             true,
+	"additionalProperties": true,
+	"items":                true,
+	"pattern":              true,
+	"minimum":              true,
+	"maximum":              true,
+	"minLength":            true,
+	"minItems":             true,
+	"anyOf":                true,
+
+	"$schema":     true,
+	"$id":         true,
+	"$comment":    true,
+	"title":       true,
+	"description": true,
+	"default":     true,
+	"examples":    true,
+	"deprecated":  true,
+}
+
+// schemaTypes is the type keyword, which is either a single type or a list of them.
+type schemaTypes []string
+
+func (t *schemaTypes) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = schemaTypes{single}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return errors.Str("type should be a string or a list of strings")
+	}
+
+	*t = list
+	return nil
+}
+
+// additional is the additionalProperties keyword: either a boolean or a schema.
+type additional struct {
+	allowed bool
+	schema  *schema
+}
+
+func (a *additional) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &a.allowed); err == nil {
+		return nil
+	}
+
+	a.allowed = true
+	return json.Unmarshal(data, &a.schema)
+}
+
+// compileSchema parses a JSON Schema document. Property names are lowercased, the same
+// way viper lowercases the keys of the configuration.
+func compileSchema(data []byte) (*schema, error) {
+	s := &schema{}
+	err := json.Unmarshal(data, s)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkKeywords(data, "#")
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.compile()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// checkKeywords rejects the keywords the validator doesn't implement, in the schema and
+// in the ones it nests. The location is the JSON pointer of the schema, # for the root.
+func checkKeywords(data []byte, location string) error {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(data, &obj); err != nil {
+		// additionalProperties given as a boolean
+		return nil
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(obj)) {
+		if !keywords[name] {
+			return errors.Errorf("unsupported keyword `%s` at %s", name, location)
+		}
+	}
+
+	if raw, ok := obj["properties"]; ok {
+		var props map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &props); err != nil {
+			return err
+		}
+
+		for _, name := range slices.Sorted(maps.Keys(props)) {
+			if err := checkKeywords(props[name], location+"/properties/"+name); err != nil {
+				return err
+			}
+		}
+	}
+
+	if raw, ok := obj["anyOf"]; ok {
+		var forms []json.RawMessage
+		if err := json.Unmarshal(raw, &forms); err != nil {
+			return err
+		}
+
+		for i, form := range forms {
+			if err := checkKeywords(form, fmt.Sprintf("%s/anyOf/%d", location, i)); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, name := range []string{"items", "additionalProperties"} {
+		if raw, ok := obj[name]; ok {
+			if err := checkKeywords(raw, location+"/"+name); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *schema) compile() error {
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return err
+		}
+		s.pattern = re
+	}
+
+	if len(s.Properties) > 0 {
+		props := make(map[string]*schema, len(s.Properties))
+		for name, sub := range s.Properties {
+			props[strings.ToLower(name)] = sub
+		}
+		s.Properties = props
+	}
+
+	for i := range s.Required {
+		s.Required[i] = strings.ToLower(s.Required[i])
+	}
+
+	children := make([]*schema, 0, len(s.Properties)+len(s.AnyOf)+2)
+	for _, sub := range s.Properties {
+		children = append(children, sub)
+	}
+	children = append(children, s.AnyOf...)
+	children = append(children, s.Items)
+	if s.AdditionalProperties != nil {
+		children = append(children, s.AdditionalProperties.schema)
+	}
+
+	for _, sub := range children {
+		if sub == nil {
+			continue
+		}
+
+		if err := sub.compile(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validate checks val against the schema and returns every violation found, key is
+// the dotted path of val.
+func (s *schema) validate(key string, val any) []Violation {
+	if s == nil {
+		return nil
+	}
+
+	var out []Violation
+	report := func(format string, args ...any) {
+		out = append(out, Violation{Key: key, Message: fmt.Sprintf(format, args...)})
+	}
+
+	actual := jsonType(val)
+	if len(s.Type) > 0 && !slices.ContainsFunc(s.Type, func(t string) bool { return typeMatches(t, actual) }) {
+		report("expected %s, got %s", strings.Join(s.Type, " or "), actual)
+		// the remaining keywords describe a value of another type
+		return out
+	}
+
+	if len(s.Enum) > 0 && !slices.ContainsFunc(s.Enum, func(e any) bool { return sameValue(e, val) }) {
+		report("value `%v` is not one of %v", val, s.Enum)
+	}
+
+	if len(s.AnyOf) > 0 && !slices.ContainsFunc(s.AnyOf, func(sub *schema) bool { return len(sub.validate(key, val)) == 0 }) {
+		report("value does not match any of the allowed forms")
+	}
+
+	switch t := val.(type) {
+	case string:
+		if s.pattern != nil && !s.pattern.MatchString(t) {
+			report("value `%s` does not match `%s`", t, s.Pattern)
+		}
+		if s.MinLength != nil && len(t) < *s.MinLength {
+			report("value should be at least %d characters long", *s.MinLength)
+		}
+	case map[string]any:
+		out = append(out, s.validateObject(key, t)...)
+	default:
+		if items, ok := asSlice(val); ok {
+			if s.MinItems != nil && len(items) < *s.MinItems {
+				report("expected at least %d items, got %d", *s.MinItems, len(items))
+			}
+			for i, item := range items {
+				out = append(out, s.Items.validate(fmt.Sprintf("%s[%d]", key, i), item)...)
+			}
+			break
+		}
+
+		if num, ok := asNumber(val); ok {
+			if s.Minimum != nil && num < *s.Minimum {
+				report("value %v is less than the minimum %v", val, *s.Minimum)
+			}
+			if s.Maximum != nil && num > *s.Maximum {
+				report("value %v is greater than the maximum %v", val, *s.Maximum)
+			}
+		}
+	}
+
+	return out
+}
+
+func (s *schema) validateObject(key string, obj map[string]any) []Violation {
+	var out []Violation
+
+	for _, name := range s.Required {
+		if _, ok := obj[name]; !ok {
+			out = append(out, Violation{Key: joinKey(key, name), Message: "required key is missing"})
+		}
+	}
+
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	// the report is stable regardless of the map order
+	slices.Sort(names)
+
+	for _, name := range names {
+		if sub, ok := s.Properties[name]; ok {
+			out = append(out, sub.validate(joinKey(key, name), obj[name])...)
+			continue
+		}
+
+		if s.AdditionalProperties == nil {
+			continue
+		}
+
+		if !s.AdditionalProperties.allowed {
+			out = append(out, Violation{Key: joinKey(key, name), Message: "unknown key"})
+			continue
+		}
+
+		out = append(out, s.AdditionalProperties.schema.validate(joinKey(key, name), obj[name])...)
+	}
+
+	return out
+}
+
+// RegisterSchema registers a JSON Schema fragment for the section, which is validated
+// right away and on every reload, or by Init for a fragment registered before it. A
+// missing section is not an error, the fragment only applies once the section is
+// present.
+func (p *Plugin) RegisterSchema(section string, fragment []byte) error {
+	const op = errors.Op("config_plugin_register_schema")
+	s, err := compileSchema(fragment)
+	if err != nil {
+		return errors.E(op, errors.Errorf("invalid schema for the section `%s`: %v", section, err))
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.schemas == nil {
+		p.schemas = make(map[string]*schema)
+	}
+
+	section = strings.ToLower(section)
+	if p.viper != nil {
+		if violations := validateSection(p.viper.AllSettings(), section, s); len(violations) > 0 {
+			return errors.E(op, violationsError(violations))
+		}
+	}
+
+	p.schemas[section] = s
+
+	return nil
+}
+
+// validateSchemas checks the whole configuration against the core schema and every
+// registered fragment, and returns all the violations at once.
+func (p *Plugin) validateSchemas(settings map[string]any) error {
+	core, err := compiledCoreSchema()
+	if err != nil {
+		return err
+	}
+
+	violations := core.validate("", settings)
+
+	p.mu.RLock()
+	sections := make([]string, 0, len(p.schemas))
+	for section := range p.schemas {
+		sections = append(sections, section)
+	}
+	slices.Sort(sections)
+
+	for _, section := range sections {
+		violations = append(violations, validateSection(settings, section, p.schemas[section])...)
+	}
+	p.mu.RUnlock()
+
+	if len(violations) > 0 {
+		return violationsError(violations)
+	}
+
+	return nil
+}
+
+// validateSection validates the value found under the dotted section, if any.
+func validateSection(settings map[string]any, section string, s *schema) []Violation {
+	val, ok := lookupKey(settings, section)
+	if !ok {
+		return nil
+	}
+
+	return s.validate(section, val)
+}
+
+func violationsError(violations []Violation) error {
+	return listViolations("configuration does not match the schema", violations)
+}
+
+// listViolations builds an error listing the violations one per line, under the title.
+func listViolations(title string, violations []Violation) error {
+	lines := make([]string, 0, len(violations))
+	for _, v := range violations {
+		lines = append(lines, "\t"+v.String())
+	}
+
+	return errors.Errorf("%s:\n%s", title, strings.Join(lines, "\n"))
+}
+
+// lookupKey walks the nested maps along the dotted key.
+func lookupKey(settings map[string]any, key string) (any, bool) {
+	var cur any = settings
+	for part := range strings.SplitSeq(key, ".") {
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+
+		cur, ok = m[part]
+		if !ok {
+			return nil, false
+		}
+	}
+
+	return cur, true
+}
+
+func joinKey(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+
+	return parent + "." + name
+}
+
+// jsonType names the JSON type of a value decoded from the configuration.
+func jsonType(val any) string {
+	switch t := val.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case map[string]any:
+		return "object"
+	case float32, float64:
+		if f, _ := asNumber(t); f == math.Trunc(f) {
+			return "integer"
+		}
+		return "number"
+	}
+
+	if _, ok := asSlice(val); ok {
+		return "array"
+	}
+
+	if _, ok := asNumber(val); ok {
+		return "integer"
+	}
+
+	return fmt.Sprintf("%T", val)
+}
+
+// typeMatches reports whether a value of the actual type satisfies the wanted type, an
+// integer is a number as well.
+func typeMatches(want, actual string) bool {
+	return want == actual || want == "number" && actual == "integer"
+}
+
+func asSlice(val any) ([]any, bool) {
+	rv := reflect.ValueOf(val)
+	if rv.Kind() != reflect.Slice {
+		return nil, false
+	}
+
+	out := make([]any, rv.Len())
+	for i := range out {
+		out[i] = rv.Index(i).Interface()
+	}
+
+	return out, true
+}
+
+func asNumber(val any) (float64, bool) {
+	rv := reflect.ValueOf(val)
+	switch rv.Kind() { //nolint:exhaustive
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	default:
+		return 0, false
+	}
+}
+
+// sameValue compares an enum entry decoded from JSON with a configuration value, where
+// numbers of different Go types are equal when their values are.
+func sameValue(enum, val any) bool {
+	a, aok := asNumber(enum)
+	b, bok := asNumber(val)
+	if aok && bok {
+		return a == b
+	}
+
+	return reflect.DeepEqual(enum, val)
+}
@@ -0,0 +1,294 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoreSchemaRejectsInvalidSections(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{
+			name: "wrong type",
+			body: "version: \"3\"\nrpc:\n  listen: 123\n",
+			want: []string{"rpc.listen: expected string, got integer"},
+		},
+		{
+			name: "one of several types",
+			body: "version: \"3\"\nserver:\n  command: 1\n",
+			want: []string{"server.command: expected string or array, got integer"},
+		},
+		{
+			name: "pattern mismatch",
+			body: "version: \"3\"\nrpc:\n  listen: 127.0.0.1:6391\n",
+			want: []string{"rpc.listen: value `127.0.0.1:6391` does not match"},
+		},
+		{
+			name: "list item of a wrong type",
+			body: "version: \"3\"\nlogs:\n  output: [[nested]]\n",
+			want: []string{"logs.output[0]: expected string, got array"},
+		},
+		{
+			name: "every violation is reported",
+			body: "version: \"3\"\nrpc:\n  listen: 123\nlogs:\n  level: [debug]\n  mode: 1\n",
+			want: []string{"rpc.listen: expected string", "logs.level: expected string, got array", "logs.mode: expected string, got integer"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Plugin{Path: writeYAML(t, tt.body)}
+
+			err := p.Init()
+			require.ErrorContains(t, err, "configuration does not match the schema")
+			for _, want := range tt.want {
+				assert.ErrorContains(t, err, want)
+			}
+		})
+	}
+}
+
+// TestCoreSchemaSeesFlags checks that the schema validates the configuration after the
+// flags are applied, so a flag can fix or break a value the file holds.
+func TestCoreSchemaSeesFlags(t *testing.T) {
+	p := &Plugin{
+		Path:  writeYAML(t, "version: \"3\"\nrpc:\n  listen: 123\n"),
+		Flags: []string{"rpc.listen=tcp://127.0.0.1:6391"},
+	}
+	require.NoError(t, p.Init())
+
+	p = &Plugin{
+		Path:  writeYAML(t, rpcConfig),
+		Flags: []string{"logs.mode=[development]"},
+	}
+	require.ErrorContains(t, p.Init(), "logs.mode: expected string, got array")
+}
+
+// TestCoreSchemaLeavesPluginSectionsOpen checks that the core schema doesn't second-guess
+// the rpc and logger plugins: their sections take the options and values those plugins
+// define, even the ones the core doesn't know of.
+func TestCoreSchemaLeavesPluginSectionsOpen(t *testing.T) {
+	p := &Plugin{Path: writeYAML(t, `version: "3"
+rpc:
+  listen: tcp://127.0.0.1:6391
+  tls:
+    cert: cert.pem
+logs:
+  mode: verbose
+  level: trace
+  encoding: logfmt
+  sampling:
+    initial: 100
+`)}
+	require.NoError(t, p.Init())
+
+	// the owning plugin closes its section by registering a fragment
+	err := p.RegisterSchema("logs", []byte(`{
+  "type": "object",
+  "additionalProperties": false,
+  "properties": {
+    "mode": {"enum": ["development", "production", "raw", "off", "none"]},
+    "level": {"type": "string"},
+    "encoding": {"type": "string"}
+  }
+}`))
+	require.ErrorContains(t, err, "logs.mode: value `verbose` is not one of")
+	assert.ErrorContains(t, err, "logs.sampling: unknown key")
+}
+
+// TestCoreSchemaLeavesTopLevelTyposToUnusedKeys pins where a misspelled section is
+// reported: not by the schema, which can't know the sections of every plugin, but as an
+// unused key once the plugins are initialized.
+func TestCoreSchemaLeavesTopLevelTyposToUnusedKeys(t *testing.T) {
+	p := &Plugin{Path: writeYAML(t, "version: \"3\"\nrcp:\n  listen: tcp://127.0.0.1:6391\n")}
+	require.NoError(t, p.Init())
+
+	assert.False(t, p.Has("rpc"))
+	assert.Equal(t, []string{"rcp"}, p.UnusedKeys())
+}
+
+// TestCoreSchemaAcceptsDecodableValues checks the values the server plugin decodes, a
+// numeric user or group id and a timeout in nanoseconds.
+func TestCoreSchemaAcceptsDecodableValues(t *testing.T) {
+	p := &Plugin{Path: writeYAML(t, `version: "3"
+server:
+  command: php worker.php
+  user: 1000
+  group: 1000
+  relay_timeout: 60000000000
+`)}
+	require.NoError(t, p.Init())
+
+	var server struct {
+		User         string        `mapstructure:"user"`
+		RelayTimeout time.Duration `mapstructure:"relay_timeout"`
+	}
+	require.NoError(t, p.UnmarshalKey("server", &server))
+	assert.Equal(t, "1000", server.User)
+	assert.Equal(t, time.Minute, server.RelayTimeout)
+}
+
+// TestCoreSchemaAcceptsIncludeFlag checks the include list a flag passes, a single string
+// holding the paths.
+func TestCoreSchemaAcceptsIncludeFlag(t *testing.T) {
+	dir := t.TempDir()
+	http := writeFile(t, dir, "http.yaml", "version: \"3\"\nhttp:\n  address: 127.0.0.1:8080\n")
+	kv := writeFile(t, dir, "kv.yaml", "version: \"3\"\nkv:\n  local:\n    driver: memory\n")
+
+	p := &Plugin{Path: writeYAML(t, rpcConfig), Flags: []string{"include=" + http}}
+	require.NoError(t, p.Init())
+	assert.Equal(t, "127.0.0.1:8080", p.Get("http.address"))
+
+	p = &Plugin{Path: writeYAML(t, rpcConfig), Flags: []string{"include=" + http + " " + kv}}
+	require.NoError(t, p.Init())
+	assert.Equal(t, "memory", p.Get("kv.local.driver"))
+}
+
+func TestCoreSchemaSeesIncludes(t *testing.T) {
+	dir := t.TempDir()
+	sub := writeFile(t, dir, ".rr-sub.yaml", "version: \"3\"\nlogs:\n  encoding: [json]\n")
+
+	p := &Plugin{Path: rootWithIncludes(t, dir, "", sub)}
+
+	require.ErrorContains(t, p.Init(), "logs.encoding: expected string, got array")
+}
+
+func TestRegisterSchema(t *testing.T) {
+	p := initFromYAML(t, `version: "3"
+http:
+  address: 127.0.0.1:8080
+  pool:
+    num_workers: 4
+`)
+
+	require.NoError(t, p.RegisterSchema("http", []byte(`{
+  "type": "object",
+  "required": ["address"],
+  "properties": {
+    "address": {"type": "string"},
+    "pool": {
+      "type": "object",
+      "properties": {"num_workers": {"type": "integer", "minimum": 1}}
+    }
+  }
+}`)))
+
+	// A fragment for a section the configuration lacks is not checked.
+	require.NoError(t, p.RegisterSchema("kv", []byte(`{"type": "object", "required": ["driver"]}`)))
+
+	err := p.RegisterSchema("http.pool", []byte(`{
+  "type": "object",
+  "required": ["max_jobs"],
+  "properties": {"num_workers": {"type": "integer", "maximum": 2}}
+}`))
+	require.ErrorContains(t, err, "http.pool.max_jobs: required key is missing")
+	assert.ErrorContains(t, err, "http.pool.num_workers: value 4 is greater than the maximum 2")
+}
+
+func TestRegisterSchemaBeforeInit(t *testing.T) {
+	p := &Plugin{Path: writeYAML(t, "version: \"3\"\nhttp:\n  address: 8080\n")}
+	require.NoError(t, p.RegisterSchema("http", []byte(`{"properties": {"address": {"type": "string"}}}`)))
+
+	require.ErrorContains(t, p.Init(), "http.address: expected string, got integer")
+}
+
+func TestRegisterSchemaInvalidFragment(t *testing.T) {
+	p := initFromYAML(t, rpcConfig)
+
+	require.ErrorContains(t, p.RegisterSchema("http", []byte(`{"type": 1}`)), "invalid schema for the section `http`")
+	require.ErrorContains(t, p.RegisterSchema("http", []byte(`{"pattern": "("}`)), "invalid schema for the section `http`")
+}
+
+// TestRegisterSchemaUnsupportedKeyword checks that a fragment stating a constraint the
+// validator doesn't implement is refused, rather than never checked.
+func TestRegisterSchemaUnsupportedKeyword(t *testing.T) {
+	p := initFromYAML(t, rpcConfig)
+
+	tests := []struct {
+		fragment string
+		want     string
+	}{
+		{`{"type": "object", "oneOf": [{"required": ["address"]}]}`, "unsupported keyword `oneOf` at #"},
+		{`{"properties": {"address": {"type": "string", "maxLength": 64}}}`, "unsupported keyword `maxLength` at #/properties/address"},
+		{`{"properties": {"pool": {"$ref": "#/$defs/pool"}}}`, "unsupported keyword `$ref` at #/properties/pool"},
+		{`{"items": {"const": 1}}`, "unsupported keyword `const` at #/items"},
+		{`{"anyOf": [{"type": "string"}, {"type": "string", "format": "uri"}]}`, "unsupported keyword `format` at #/anyOf/1"},
+		{`{"additionalProperties": {"exclusiveMinimum": 0}}`, "unsupported keyword `exclusiveMinimum` at #/additionalProperties"},
+	}
+
+	for _, tt := range tests {
+		err := p.RegisterSchema("http", []byte(tt.fragment))
+		require.ErrorContains(t, err, "invalid schema for the section `http`")
+		assert.ErrorContains(t, err, tt.want)
+	}
+
+	// the annotations don't constrain the value
+	require.NoError(t, p.RegisterSchema("http", []byte(`{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "title": "HTTP plugin",
+  "properties": {"address": {"type": "string", "description": "host:port", "default": "127.0.0.1:8080"}},
+  "additionalProperties": false
+}`)))
+}
+
+// TestRegisteredSchemaGuardsReload checks that a fragment keeps guarding the section
+// once registered: a reload that breaks it is rejected.
+func TestRegisteredSchemaGuardsReload(t *testing.T) {
+	path := writeYAML(t, "version: \"3\"\nhttp:\n  address: 127.0.0.1:8080\n")
+	p := &Plugin{Path: path}
+	require.NoError(t, p.Init())
+	require.NoError(t, p.RegisterSchema("http", []byte(`{"properties": {"address": {"type": "string"}}}`)))
+
+	rewrite(t, path, "version: \"3\"\nhttp:\n  address: 8080\n")
+
+	require.ErrorContains(t, p.Reload(), "http.address: expected string, got integer")
+	assert.Equal(t, "127.0.0.1:8080", p.Get("http.address"))
+}
+
+func TestSchemaKeywords(t *testing.T) {
+	s, err := compileSchema([]byte(`{
+  "type": "object",
+  "additionalProperties": {"type": "object", "required": ["driver"]},
+  "properties": {
+    "Name": {"type": "string", "minLength": 3},
+    "ratio": {"type": "number"},
+    "tags": {"type": "array", "minItems": 1, "items": {"type": "string"}},
+    "mode": {"enum": [1, "two"]},
+    "target": {"anyOf": [{"type": "string"}, {"type": "object", "required": ["path"]}]}
+  }
+}`))
+	require.NoError(t, err)
+
+	valid := map[string]any{
+		"name":   "abc",
+		"ratio":  1,
+		"tags":   []string{"a"},
+		"mode":   int64(1),
+		"target": map[string]any{"path": "x"},
+		"store":  map[string]any{"driver": "memory"},
+	}
+	assert.Empty(t, s.validate("", valid))
+
+	invalid := map[string]any{
+		"name":   "ab",
+		"ratio":  "1",
+		"tags":   []any{},
+		"mode":   "one",
+		"target": 5,
+		"store":  map[string]any{},
+	}
+	assert.Equal(t, []Violation{
+		{Key: "mode", Message: "value `one` is not one of [1 two]"},
+		{Key: "name", Message: "value should be at least 3 characters long"},
+		{Key: "ratio", Message: "expected number, got string"},
+		{Key: "store.driver", Message: "required key is missing"},
+		{Key: "tags", Message: "expected at least 1 items, got 0"},
+		{Key: "target", Message: "value does not match any of the allowed forms"},
+	}, s.validate("", invalid))
+}
@@ -119,8 +119,8 @@ func StartExpectInitError(t *testing.T, cfgPath string, plugins []any, opts ...O
 	return err
 }
 
-// newContainer builds the container and registers the config, the logger and the
-// caller's plugins. The container is not initialized yet.
+// newContainer builds the container and registers the config, the logger, the bridge
+// between them and the caller's plugins. The container is not initialized yet.
 func newContainer(t *testing.T, cfgPath string, plugins []any, opts []Option) (*endure.Endure, *bootCfg) {
 	t.Helper()
 
@@ -129,8 +129,8 @@ func newContainer(t *testing.T, cfgPath string, plugins []any, opts []Option) (*
 		o(bc)
 	}
 
-	all := make([]any, 0, 2+len(plugins))
-	all = append(all, &config.Plugin{Version: ConfigVersion, Path: cfgPath, Flags: bc.flags}, &logger.Plugin{})
+	all := make([]any, 0, 3+len(plugins))
+	all = append(all, &config.Plugin{Version: ConfigVersion, Path: cfgPath, Flags: bc.flags}, &logger.Plugin{}, &config.LoggerBridge{})
 	all = append(all, plugins...)
 
 	cont := endure.New(slog.LevelDebug)
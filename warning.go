@@ -0,0 +1,166 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// WarningKind classifies a Warning.
+type WarningKind string
+
+const (
+	// WarningDeprecatedVersion is a configuration declaring a deprecated version.
+	WarningDeprecatedVersion WarningKind = "deprecated_version"
+	// WarningDeprecatedKey is a configuration setting a deprecated key.
+	WarningDeprecatedKey WarningKind = "deprecated_key"
+	// WarningUnusedEnv is an env variable carrying EnvPrefix that wasn't applied.
+	WarningUnusedEnv WarningKind = "unused_env"
+	// WarningIgnoredFlag is a flag that had no effect.
+	WarningIgnoredFlag WarningKind = "ignored_flag"
+	// WarningUnusedKey is a part of the configuration no plugin accessed.
+	WarningUnusedKey WarningKind = "unused_key"
+	// WarningReloadRejected is a reload that failed, the previous configuration is kept.
+	WarningReloadRejected WarningKind = "reload_rejected"
+)
+
+// Warning is something wrong with the configuration that doesn't prevent RoadRunner
+// from starting.
+type Warning struct {
+	Kind    WarningKind
+	Message string
+	// Key is the configuration key the warning is about, if any.
+	Key string
+	// Fields carry the details, such as the env variable or the flag involved.
+	Fields map[string]string
+}
+
+// Logger is the RoadRunner logger plugin.
+type Logger interface {
+	NamedLogger(name string) *zap.Logger
+}
+
+// Warnings returns the warnings raised since Init, in order. A warning raised again by
+// a reload is only reported once.
+func (p *Plugin) Warnings() []Warning {
+	p.warnMu.Lock()
+	defer p.warnMu.Unlock()
+
+	return slices.Clone(p.warnings)
+}
+
+// SetLogger makes the plugin emit its warnings through the logger plugin, the ones
+// raised so far included. The logger plugin depends on the configuration, so the config
+// plugin can't take it in its Init: the LoggerBridge plugin calls SetLogger once both are
+// initialized. Without a logger, the warnings are written to stderr once the plugin is
+// served.
+func (p *Plugin) SetLogger(l Logger) {
+	log := l.NamedLogger(PluginName)
+
+	p.warnMu.Lock()
+	defer p.warnMu.Unlock()
+
+	p.log = log
+	for _, w := range p.warnings {
+		logWarning(log, w)
+	}
+}
+
+// warn records the warnings not seen yet and emits them, through the logger when there
+// is one. Before the plugin is served, a warning is only recorded. Every rejected reload
+// is reported, even one failing the same way as the previous one.
+func (p *Plugin) warn(warnings ...Warning) {
+	p.warnMu.Lock()
+	defer p.warnMu.Unlock()
+
+	for _, w := range warnings {
+		seen := slices.ContainsFunc(p.warnings, func(seen Warning) bool { return sameWarning(seen, w) })
+		if seen && w.Kind != WarningReloadRejected {
+			continue
+		}
+
+		p.warnings = append(p.warnings, w)
+
+		switch {
+		case p.log != nil:
+			logWarning(p.log, w)
+		case p.served:
+			printWarning(w)
+		}
+	}
+}
+
+// flushWarnings writes the recorded warnings to stderr when no logger was set by the time
+// the plugin is served, the later ones follow as they are raised.
+func (p *Plugin) flushWarnings() {
+	p.warnMu.Lock()
+	defer p.warnMu.Unlock()
+
+	if p.served {
+		return
+	}
+
+	p.served = true
+	if p.log != nil {
+		return
+	}
+
+	for _, w := range p.warnings {
+		printWarning(w)
+	}
+}
+
+func sameWarning(a, b Warning) bool {
+	return a.Kind == b.Kind && a.Key == b.Key && a.Message == b.Message && maps.Equal(a.Fields, b.Fields)
+}
+
+func logWarning(log *zap.Logger, w Warning) {
+	fields := make([]zap.Field, 0, len(w.Fields)+2)
+	fields = append(fields, zap.String("kind", string(w.Kind)))
+	if w.Key != "" {
+		fields = append(fields, zap.String("key", w.Key))
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(w.Fields)) {
+		fields = append(fields, zap.String(name, w.Fields[name]))
+	}
+
+	log.Warn(w.Message, fields...)
+}
+
+// printWarning writes the warning to stderr, on a line carrying its kind, key and
+// fields, the values quoted when they hold spaces.
+func printWarning(w Warning) {
+	_, _ = fmt.Fprintln(os.Stderr, formatWarning(w))
+}
+
+// formatWarning renders the warning as a line: WARN config: message kind=... key=...
+// and the fields sorted by name.
+func formatWarning(w Warning) string {
+	var sb strings.Builder
+	sb.WriteString("WARN " + PluginName + ": " + w.Message)
+
+	field := func(name, val string) {
+		if strings.ContainsAny(val, " \t\"=") || val == "" {
+			val = strconv.Quote(val)
+		}
+
+		sb.WriteString(" " + name + "=" + val)
+	}
+
+	field("kind", string(w.Kind))
+	if w.Key != "" {
+		field("key", w.Key)
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(w.Fields)) {
+		field(name, w.Fields[name])
+	}
+
+	return sb.String()
+}
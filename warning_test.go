@@ -0,0 +1,93 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+type testLogger struct {
+	log *zap.Logger
+}
+
+func (l testLogger) NamedLogger(name string) *zap.Logger {
+	return l.log.Named(name)
+}
+
+func observedLogger() (testLogger, *observer.ObservedLogs) {
+	core, logs := observer.New(zapcore.WarnLevel)
+	return testLogger{log: zap.New(core)}, logs
+}
+
+func TestDeprecatedVersionWarning(t *testing.T) {
+	p := initFromYAML(t, legacyJobsConfig)
+
+	assert.Equal(t, []Warning{{
+		Kind:    WarningDeprecatedVersion,
+		Message: "please, update your configuration version from version: '2.7' to version: '3', see changes here: https://docs.roadrunner.dev/docs/general/compatibility#v3.0-configuration-and-rr-v2023.x.x",
+		Key:     "version",
+		Fields:  map[string]string{"version": "2.7", "migrated_keys": "3"},
+	}}, p.Warnings())
+
+	assert.Empty(t, initFromYAML(t, rpcConfig).Warnings())
+}
+
+// TestWarningsReachLogger checks that the warnings raised before the logger is set are
+// emitted once it is, with their fields.
+func TestWarningsReachLogger(t *testing.T) {
+	t.Setenv("CFGTEST_HTTP", "plain")
+
+	p := &Plugin{
+		Path:      writeYAML(t, envBindConfig),
+		EnvPrefix: "CFGTEST",
+		Flags:     []string{"http.missing!"},
+	}
+	require.NoError(t, p.Init())
+
+	log, logs := observedLogger()
+	p.SetLogger(log)
+
+	entries := logs.AllUntimed()
+	require.Len(t, entries, 2)
+
+	assert.Equal(t, "config", entries[0].LoggerName)
+	assert.Equal(t, "the env variable names a section, which can't be replaced from the environment, it's ignored", entries[0].Message)
+	assert.Equal(t, map[string]any{"kind": "unused_env", "key": "http", "env": "CFGTEST_HTTP"}, entries[0].ContextMap())
+
+	assert.Equal(t, map[string]any{"kind": "ignored_flag", "key": "http.missing", "flag": "http.missing!"}, entries[1].ContextMap())
+
+	// a warning raised after the logger is set is emitted right away
+	p.warn(Warning{Kind: WarningDeprecatedKey, Message: "deprecated", Key: "a.b"})
+	assert.Equal(t, 3, logs.Len())
+}
+
+func TestWarningsAreReportedOnce(t *testing.T) {
+	path := writeYAML(t, legacyJobsConfig)
+	p := &Plugin{Path: path}
+	require.NoError(t, p.Init())
+
+	log, logs := observedLogger()
+	p.SetLogger(log)
+	require.Equal(t, 1, logs.Len())
+
+	require.NoError(t, p.Reload())
+
+	assert.Len(t, p.Warnings(), 1)
+	assert.Equal(t, 1, logs.Len())
+}
+
+func TestFormatWarning(t *testing.T) {
+	w := Warning{
+		Kind:    WarningReloadRejected,
+		Message: "configuration reload rejected, the previous configuration is kept",
+		Key:     "http.pool",
+		Fields:  map[string]string{"error": "version mismatch", "env": "RR_X", "empty": ""},
+	}
+
+	assert.Equal(t, `WARN config: configuration reload rejected, the previous configuration is kept kind=reload_rejected key=http.pool empty="" env=RR_X error="version mismatch"`, formatWarning(w))
+	assert.Equal(t, "WARN config: unused kind=unused_key key=kv", formatWarning(Warning{Kind: WarningUnusedKey, Message: "unused", Key: "kv"}))
+}